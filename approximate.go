@@ -0,0 +1,55 @@
+package lsm
+
+import "bytes"
+
+// ApproximateSize return the approximate size in bytes of user keys [start, end),
+// nil means unbounded. It is estimated from the index blocks of sstables and the memdbs
+// without reading data blocks, shadowed versions and tombstones are counted.
+func (lsm *LSM) ApproximateSize(start, end []byte) uint64 {
+	size, _ := lsm.defaultCF.approximate(start, end)
+	return size
+}
+
+// ApproximateCount return the approximate number of entries of user keys [start, end),
+// which is estimated as ApproximateSize.
+func (lsm *LSM) ApproximateCount(start, end []byte) uint64 {
+	_, count := lsm.defaultCF.approximate(start, end)
+	return count
+}
+
+// ApproximateSize is LSM.ApproximateSize of column family.
+func (cf *ColumnFamily) ApproximateSize(start, end []byte) uint64 {
+	size, _ := cf.approximate(start, end)
+	return size
+}
+
+// ApproximateCount is LSM.ApproximateCount of column family.
+func (cf *ColumnFamily) ApproximateCount(start, end []byte) uint64 {
+	_, count := cf.approximate(start, end)
+	return count
+}
+
+// approximate return the size and number of entries of user keys [start, end) in memdbs
+// and sstables. data blocks overlapping the range are counted entirely.
+func (cf *ColumnFamily) approximate(start, end []byte) (size, count uint64) {
+	lsm := cf.lsm
+	if lsm.closed.Load() || start != nil && end != nil && bytes.Compare(start, end) >= 0 {
+		return 0, 0
+	}
+
+	lsm.mu.RLock()
+	if lsm.cfs[cf.id] != cf {
+		lsm.mu.RUnlock()
+		return 0, 0
+	}
+	size, count = cf.db.Approximate(start, end)
+	for _, db := range cf.dbList {
+		s, n := db.Approximate(start, end)
+		size += s
+		count += n
+	}
+	lsm.mu.RUnlock()
+
+	s, n := cf.index.Approximate(start, end)
+	return size + s, count + n
+}
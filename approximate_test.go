@@ -0,0 +1,69 @@
+package lsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApproximate(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	// level1.
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+
+	// level0.
+	for i := 0; i < num; i += 2 {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 1)))
+	}
+	assert.Nil(lsm.Flush(true))
+
+	// memdbs.
+	for i := num; i < num+100; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	assert.Nil(lsm.rotate())
+	for i := num + 100; i < num+200; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+
+	// all entries are counted.
+	total := uint64(num + num/2 + 200)
+	assert.Equal(total, lsm.ApproximateCount(nil, nil))
+	size := lsm.ApproximateSize(nil, nil)
+	assert.Greater(size, uint64(0))
+
+	// tables are estimated by data blocks.
+	count := lsm.ApproximateCount(getKey(0), getKey(num/2))
+	assert.InDelta(num/2+num/4, count, num/20)
+	assert.InEpsilon(size/2, lsm.ApproximateSize(getKey(0), getKey(num/2)), 0.2)
+	assert.InDelta(num/2+num/4, lsm.ApproximateCount(getKey(num/4), getKey(num*3/4)), num/20)
+
+	// memdbs are counted exactly.
+	assert.Equal(uint64(200), lsm.ApproximateCount(getKey(num), nil))
+	assert.Equal(uint64(150), lsm.ApproximateCount(getKey(num+50), getKey(num+200)))
+
+	// empty ranges.
+	assert.Equal(uint64(0), lsm.ApproximateCount(getKey(num+200), nil))
+	assert.Equal(uint64(0), lsm.ApproximateSize(getKey(1), getKey(0)))
+	assert.Equal(uint64(0), lsm.ApproximateCount(getKey(1), getKey(1)))
+
+	// column family.
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+	for i := 0; i < 100; i++ {
+		assert.Nil(users.Put(getKey(i), getValue(i, 0)))
+	}
+	assert.Equal(uint64(100), users.ApproximateCount(nil, nil))
+	assert.Greater(users.ApproximateSize(nil, nil), uint64(0))
+	assert.Nil(lsm.DropColumnFamily(users))
+	assert.Equal(uint64(0), users.ApproximateCount(nil, nil))
+}
@@ -0,0 +1,232 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/memdb"
+)
+
+const (
+	// batch header: seq(8) + count(4).
+	batchHeaderSize = 12
+
+	// batchCFFlag is set in kind if the entry belongs to a column family other than the default.
+	batchCFFlag = 0x80
+)
+
+var (
+	ErrBatch = errors.New("lsm: invalid write batch")
+)
+
+// WriteBatch is a batch of Put, PutWithTTL, Delete, DeleteRange and Merge, which is applied atomically by LSM.Write.
+// The entries may belong to different column families by the CF methods.
+// The zero value is an empty batch ready to use.
+//
+// format: seq(8) + count(4) + entries,
+// entry: kind(1) + [cf(uvarint) if batchCFFlag is set] + keyLen(uvarint) + key + valueLen(uvarint) + value.
+// the entries are assigned with sequence numbers seq, seq+1, ... in order.
+type WriteBatch struct {
+	data []byte
+
+	// tooLarge is true if any value is too large for memdb.
+	tooLarge bool
+}
+
+// Put
+func (b *WriteBatch) Put(key, value []byte) {
+	b.PutCF(nil, key, value)
+}
+
+// PutCF puts into column family cf, nil means the default column family.
+func (b *WriteBatch) PutCF(cf *ColumnFamily, key, value []byte) {
+	b.append(cf.ID(), key, value, ikey.KindVal)
+}
+
+// PutWithTTL puts a value which expires after ttl.
+func (b *WriteBatch) PutWithTTL(key, value []byte, ttl time.Duration) {
+	b.PutWithTTLCF(nil, key, value, ttl)
+}
+
+// PutWithTTLCF
+func (b *WriteBatch) PutWithTTLCF(cf *ColumnFamily, key, value []byte, ttl time.Duration) {
+	buf := make([]byte, memdb.ExpireSize, memdb.ExpireSize+len(value))
+	binary.BigEndian.PutUint64(buf, uint64(time.Now().Add(ttl).UnixNano()))
+	b.append(cf.ID(), key, append(buf, value...), ikey.KindExpire)
+}
+
+// Delete records a tombstone of key.
+func (b *WriteBatch) Delete(key []byte) {
+	b.DeleteCF(nil, key)
+}
+
+// DeleteCF
+func (b *WriteBatch) DeleteCF(cf *ColumnFamily, key []byte) {
+	b.append(cf.ID(), key, nil, ikey.KindDel)
+}
+
+// DeleteRange records a range tombstone of keys in [start, end), nothing is recorded
+// if start >= end.
+func (b *WriteBatch) DeleteRange(start, end []byte) {
+	b.DeleteRangeCF(nil, start, end)
+}
+
+// DeleteRangeCF records nothing if the range is empty.
+func (b *WriteBatch) DeleteRangeCF(cf *ColumnFamily, start, end []byte) {
+	if bytes.Compare(start, end) >= 0 {
+		return
+	}
+	b.append(cf.ID(), start, end, ikey.KindRangeDel)
+}
+
+// Merge records a merge operand of key, which is merged by option.MergeOperator.
+func (b *WriteBatch) Merge(key, operand []byte) {
+	b.MergeCF(nil, key, operand)
+}
+
+// MergeCF
+func (b *WriteBatch) MergeCF(cf *ColumnFamily, key, operand []byte) {
+	b.append(cf.ID(), key, operand, ikey.KindMerge)
+}
+
+// Len return the number of entries in batch.
+func (b *WriteBatch) Len() int {
+	if len(b.data) < batchHeaderSize {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint32(b.data[8:]))
+}
+
+// seq return the sequence number of the first entry.
+func (b *WriteBatch) seq() uint64 {
+	return binary.LittleEndian.Uint64(b.data)
+}
+
+// setSeq
+func (b *WriteBatch) setSeq(seq uint64) {
+	binary.LittleEndian.PutUint64(b.data, seq)
+}
+
+// Clear
+func (b *WriteBatch) Clear() {
+	b.data = b.data[:0]
+	b.tooLarge = false
+}
+
+// Dump return the binary format of batch, which can be restored by Load.
+func (b *WriteBatch) Dump() []byte {
+	return b.data
+}
+
+// Load replaces the batch with the binary format from Dump.
+func (b *WriteBatch) Load(data []byte) error {
+	batch := WriteBatch{data: data}
+	err := batch.iter(func(_ uint32, _, value []byte, _ ikey.Kind) {
+		batch.tooLarge = batch.tooLarge || len(value) > math.MaxUint16
+	})
+	if err != nil {
+		return err
+	}
+	batch.data = append(b.data[:0], data...)
+	*b = batch
+
+	return nil
+}
+
+// append
+func (b *WriteBatch) append(cf uint32, key, value []byte, kind ikey.Kind) {
+	if len(b.data) == 0 {
+		b.data = make([]byte, batchHeaderSize, batchHeaderSize+len(key)+len(value)+16)
+	}
+	binary.LittleEndian.PutUint32(b.data[8:], uint32(b.Len()+1))
+
+	if cf == 0 {
+		b.data = append(b.data, byte(kind))
+	} else {
+		b.data = append(b.data, byte(kind)|batchCFFlag)
+		b.data = binary.AppendUvarint(b.data, uint64(cf))
+	}
+	b.data = binary.AppendUvarint(b.data, uint64(len(key)))
+	b.data = append(b.data, key...)
+	b.data = binary.AppendUvarint(b.data, uint64(len(value)))
+	b.data = append(b.data, value...)
+
+	b.tooLarge = b.tooLarge || len(value) > math.MaxUint16
+}
+
+// appendBatch appends the entries of other.
+func (b *WriteBatch) appendBatch(other *WriteBatch) {
+	if other.Len() == 0 {
+		return
+	}
+	if len(b.data) == 0 {
+		b.data = make([]byte, batchHeaderSize, batchHeaderSize+len(other.data))
+	}
+	binary.LittleEndian.PutUint32(b.data[8:], uint32(b.Len()+other.Len()))
+	b.data = append(b.data, other.data[batchHeaderSize:]...)
+
+	b.tooLarge = b.tooLarge || other.tooLarge
+}
+
+// iter decodes the entries of batch in order, cf is the column family id.
+func (b *WriteBatch) iter(fn func(cf uint32, key, value []byte, kind ikey.Kind)) error {
+	if len(b.data) == 0 {
+		return nil
+	}
+	if len(b.data) < batchHeaderSize {
+		return ErrBatch
+	}
+	count := b.Len()
+	buf := b.data[batchHeaderSize:]
+
+	for ; count > 0; count-- {
+		if len(buf) == 0 {
+			return ErrBatch
+		}
+		kind, rest := ikey.Kind(buf[0]), buf[1:]
+
+		var cf uint64
+		if kind&batchCFFlag != 0 {
+			var n int
+			if cf, n = binary.Uvarint(rest); n <= 0 || cf > math.MaxUint32 {
+				return ErrBatch
+			}
+			kind, rest = kind&^batchCFFlag, rest[n:]
+		}
+		if kind < ikey.KindVal || kind > ikey.KindExpire {
+			return ErrBatch
+		}
+
+		key, rest, err := decodeBytes(rest)
+		if err != nil {
+			return err
+		}
+		value, rest, err := decodeBytes(rest)
+		if err != nil {
+			return err
+		}
+		if kind == ikey.KindExpire && len(value) < memdb.ExpireSize {
+			return ErrBatch
+		}
+		fn(uint32(cf), key, value, kind)
+		buf = rest
+	}
+	if len(buf) > 0 {
+		return ErrBatch
+	}
+	return nil
+}
+
+// decodeBytes decode uvarint length-prefixed bytes.
+func decodeBytes(buf []byte) ([]byte, []byte, error) {
+	n, size := binary.Uvarint(buf)
+	if size <= 0 || uint64(len(buf)-size) < n {
+		return nil, nil, ErrBatch
+	}
+	buf = buf[size:]
+	return buf[:n], buf[n:], nil
+}
@@ -0,0 +1,151 @@
+package lsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/option"
+)
+
+type batchEntry struct {
+	cf         uint32
+	key, value []byte
+	kind       ikey.Kind
+}
+
+func getBatchEntries(batch *WriteBatch) []batchEntry {
+	var entries []batchEntry
+	batch.iter(func(cf uint32, key, value []byte, kind ikey.Kind) {
+		entries = append(entries, batchEntry{cf, key, value, kind})
+	})
+	return entries
+}
+
+func TestWriteBatch(t *testing.T) {
+	assert := assert.New(t)
+
+	var batch WriteBatch
+	assert.Equal(0, batch.Len())
+	assert.Nil(batch.iter(func(uint32, []byte, []byte, ikey.Kind) {}))
+
+	cf := &ColumnFamily{id: 300}
+	for i := 0; i < 100; i++ {
+		switch i % 3 {
+		case 0:
+			batch.PutCF(cf, getKey(i), getValue(i, 0))
+		case 1:
+			batch.Delete(getKey(i))
+		case 2:
+			batch.DeleteRange(getKey(i), getKey(i+1))
+		}
+	}
+	assert.Equal(100, batch.Len())
+
+	entries := getBatchEntries(&batch)
+	assert.Equal(100, len(entries))
+	for i, e := range entries {
+		assert.Equal(getKey(i), e.key)
+		switch i % 3 {
+		case 0:
+			assert.Equal(getValue(i, 0), e.value)
+			assert.Equal(ikey.KindVal, e.kind)
+			assert.Equal(uint32(300), e.cf)
+		case 1:
+			assert.Equal(0, len(e.value))
+			assert.Equal(ikey.KindDel, e.kind)
+		case 2:
+			assert.Equal(getKey(i+1), e.value)
+			assert.Equal(ikey.KindRangeDel, e.kind)
+		}
+	}
+
+	// dump and load.
+	batch.setSeq(100)
+	var batch2 WriteBatch
+	assert.Nil(batch2.Load(batch.Dump()))
+	assert.Equal(batch.Len(), batch2.Len())
+	assert.Equal(uint64(100), batch2.seq())
+	assert.Equal(entries, getBatchEntries(&batch2))
+
+	// load invalid data.
+	data := batch.Dump()
+	assert.ErrorIs(batch2.Load(data[:len(data)-1]), ErrBatch)
+	assert.ErrorIs(batch2.Load(data[:2]), ErrBatch)
+	assert.ErrorIs(batch2.Load(append(data, 0)), ErrBatch)
+
+	// clear.
+	batch.Clear()
+	assert.Equal(0, batch.Len())
+	batch.Put(getKey(0), getValue(0, 0))
+	assert.Equal(1, batch.Len())
+}
+
+func TestWrite(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	lsm := newTestLSM(t, dir)
+
+	const num = 100
+
+	// fill memdb until it can not hold a whole batch.
+	var i int
+	for lsm.defaultCF.db.Free() > option.KB {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+		i++
+	}
+	db := lsm.defaultCF.db
+
+	var batch WriteBatch
+	for i := 0; i < num; i++ {
+		batch.Put(getKey(i), getValue(i, 1))
+	}
+	for i := num; i < num*2; i++ {
+		batch.Delete(getKey(i))
+	}
+	assert.Nil(lsm.Write(&batch))
+
+	// the whole batch is written to the new memdb with sequential sequence numbers.
+	assert.NotEqual(db, lsm.defaultCF.db)
+	assert.Equal(uint64(i+num*2), lsm.seq.Load())
+
+	var seq uint64
+	lsm.defaultCF.db.Iter(func(key ikey.Key, value []byte) {
+		seq++
+		assert.Equal(uint64(i)+seq, key.Seq())
+
+		k := int(key.Seq()) - i - 1
+		assert.Equal(getKey(k), key.UserKey())
+		if k < num {
+			assert.Equal(getValue(k, 1), value)
+			assert.Equal(ikey.KindVal, key.Kind())
+		} else {
+			assert.Equal(ikey.KindDel, key.Kind())
+		}
+	})
+	assert.Equal(uint64(num*2), seq)
+
+	checkData := func() {
+		checkGet(lsm, 0, num, 1, assert)
+		for i := num; i < num*2; i++ {
+			_, err := lsm.Get(getKey(i))
+			assert.ErrorIs(err, ErrKeyNotFound)
+		}
+	}
+	checkData()
+
+	// recover.
+	lsm.cancel()
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	checkData()
+
+	// too large.
+	batch.Clear()
+	assert.Nil(lsm.Write(&batch))
+	for i := 0; i < 10000; i++ {
+		batch.Put(getKey(i), getValue(i, 1))
+	}
+	assert.ErrorIs(lsm.Write(&batch), ErrTooLarge)
+	checkData()
+}
@@ -0,0 +1,190 @@
+// Package blob is the append-only file of large values separated from sstables,
+// which are referenced by pointers in sstables.
+package blob
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	blobExt = ".blob"
+
+	// record header: crc(4) + length(4).
+	headerSize = 8
+)
+
+var (
+	order = binary.LittleEndian
+)
+
+var (
+	ErrPointer  = errors.New("blob: invalid pointer")
+	ErrChecksum = errors.New("blob: invalid crc checksum")
+)
+
+// Pointer locates a value in blob file.
+//
+// format: file(uvarint) + offset(uvarint) + size(uvarint).
+type Pointer struct {
+	File   uint64
+	Offset uint64
+	Size   uint64
+}
+
+// Encode
+func (p Pointer) Encode() []byte {
+	buf := make([]byte, 0, 3*binary.MaxVarintLen64)
+	buf = binary.AppendUvarint(buf, p.File)
+	buf = binary.AppendUvarint(buf, p.Offset)
+	return binary.AppendUvarint(buf, p.Size)
+}
+
+// RecordSize return the size of record taken in blob file.
+func (p Pointer) RecordSize() uint64 {
+	return headerSize + p.Size
+}
+
+// Decode
+func Decode(data []byte) (Pointer, error) {
+	var p Pointer
+	for _, v := range []*uint64{&p.File, &p.Offset, &p.Size} {
+		n := 0
+		if *v, n = binary.Uvarint(data); n <= 0 {
+			return Pointer{}, ErrPointer
+		}
+		data = data[n:]
+	}
+	if len(data) > 0 {
+		return Pointer{}, ErrPointer
+	}
+	return p, nil
+}
+
+// Path return the path of blob file id in dir.
+func Path(dir string, id uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%08d%s", id, blobExt))
+}
+
+// ParsePath return the id of blob file, false if it is not a blob file.
+func ParsePath(path string) (uint64, bool) {
+	name := filepath.Base(path)
+	if !strings.HasSuffix(name, blobExt) {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, blobExt), 10, 64)
+	return id, err == nil
+}
+
+// Writer writes values to a new blob file, which is written to disk by Finish.
+type Writer struct {
+	id   uint64
+	path string
+	buf  []byte
+}
+
+// NewWriter
+func NewWriter(dir string, id uint64) *Writer {
+	return &Writer{id: id, path: Path(dir, id)}
+}
+
+// Add appends value and return the pointer of it.
+func (w *Writer) Add(value []byte) Pointer {
+	p := Pointer{File: w.id, Offset: uint64(len(w.buf)), Size: uint64(len(value))}
+	w.buf = order.AppendUint32(w.buf, crc32.ChecksumIEEE(value))
+	w.buf = order.AppendUint32(w.buf, uint32(len(value)))
+	w.buf = append(w.buf, value...)
+	return p
+}
+
+// Finish writes and syncs the blob file, nothing is written if no value is added.
+func (w *Writer) Finish() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	fd, err := os.OpenFile(w.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(w.buf); err != nil {
+		fd.Close()
+		os.Remove(w.path)
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		os.Remove(w.path)
+		return err
+	}
+	return fd.Close()
+}
+
+// Abort removes the blob file written by Finish.
+func (w *Writer) Abort() {
+	if len(w.buf) > 0 {
+		os.Remove(w.path)
+	}
+}
+
+// File is a blob file opened for reading.
+type File struct {
+	id   uint64
+	fd   *os.File
+	size uint64
+}
+
+// Open
+func Open(path string, id uint64) (*File, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return &File{id: id, fd: fd, size: uint64(stat.Size())}, nil
+}
+
+// ID
+func (f *File) ID() uint64 {
+	return f.id
+}
+
+// Size return the size of blob file.
+func (f *File) Size() uint64 {
+	return f.size
+}
+
+// Read return the value of pointer p.
+func (f *File) Read(p Pointer) ([]byte, error) {
+	if p.File != f.id || p.Offset+p.RecordSize() > f.size {
+		return nil, ErrPointer
+	}
+	buf := make([]byte, p.RecordSize())
+	if _, err := f.fd.ReadAt(buf, int64(p.Offset)); err != nil {
+		return nil, err
+	}
+	value := buf[headerSize:]
+	if order.Uint32(buf) != crc32.ChecksumIEEE(value) || uint64(order.Uint32(buf[4:])) != p.Size {
+		return nil, ErrChecksum
+	}
+	return value, nil
+}
+
+// Close
+func (f *File) Close() error {
+	return f.fd.Close()
+}
+
+// Remove closes and removes the blob file.
+func (f *File) Remove() error {
+	return errors.Join(f.fd.Close(), os.Remove(f.fd.Name()))
+}
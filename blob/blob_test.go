@@ -0,0 +1,80 @@
+package blob
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlob(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	const num = 1000
+	getValue := func(i int) []byte {
+		return []byte(fmt.Sprintf("%0*d", i%100+1, i))
+	}
+
+	w := NewWriter(dir, 1)
+	pointers := make([]Pointer, num)
+	for i := 0; i < num; i++ {
+		pointers[i] = w.Add(getValue(i))
+	}
+	assert.Nil(w.Finish())
+
+	// the file exists already.
+	w = NewWriter(dir, 1)
+	w.Add(getValue(0))
+	assert.NotNil(w.Finish())
+	id, ok := ParsePath(Path(dir, 1))
+	assert.True(ok)
+	assert.Equal(uint64(1), id)
+
+	f, err := Open(Path(dir, 1), 1)
+	assert.Nil(err)
+	var size uint64
+	for i, p := range pointers {
+		q, err := Decode(p.Encode())
+		assert.Nil(err)
+		assert.Equal(p, q)
+
+		value, err := f.Read(q)
+		assert.Nil(err)
+		assert.Equal(getValue(i), value)
+		size += p.RecordSize()
+	}
+	assert.Equal(size, f.Size())
+
+	// invalid pointers.
+	_, err = Decode(append(pointers[0].Encode(), 0))
+	assert.ErrorIs(err, ErrPointer)
+	_, err = Decode(nil)
+	assert.ErrorIs(err, ErrPointer)
+	_, err = f.Read(Pointer{File: 1, Offset: size, Size: 1})
+	assert.ErrorIs(err, ErrPointer)
+	_, err = f.Read(Pointer{File: 2})
+	assert.ErrorIs(err, ErrPointer)
+	assert.Nil(f.Close())
+
+	// corrupted record.
+	data, err := os.ReadFile(Path(dir, 1))
+	assert.Nil(err)
+	data[headerSize] ^= 0xff
+	assert.Nil(os.WriteFile(Path(dir, 1), data, 0644))
+
+	f, err = Open(Path(dir, 1), 1)
+	assert.Nil(err)
+	_, err = f.Read(pointers[0])
+	assert.ErrorIs(err, ErrChecksum)
+	assert.Nil(f.Remove())
+	_, err = os.Stat(Path(dir, 1))
+	assert.True(os.IsNotExist(err))
+
+	// empty writer writes nothing.
+	w = NewWriter(dir, 2)
+	assert.Nil(w.Finish())
+	_, err = os.Stat(Path(dir, 2))
+	assert.True(os.IsNotExist(err))
+}
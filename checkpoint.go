@@ -0,0 +1,71 @@
+package lsm
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/xgzlucario/LSM/table"
+)
+
+// Checkpoint creates a consistent copy of LSM in dir, which can be opened by NewLSM.
+// writes are blocked while the memdbs are flushed, and then the tables and blob files
+// of all column families are hard linked into dir with the column family manifest,
+// so that no data is copied. dir must not exist and must be on the same file system.
+func (lsm *LSM) Checkpoint(dir string) error {
+	lsm.writeMu.Lock()
+	defer lsm.writeMu.Unlock()
+
+	if lsm.closed.Load() {
+		return ErrClosed
+	}
+	if err := lsm.BackgroundError(); err != nil {
+		return err
+	}
+
+	// the flushed memdbs are in tables, so that the log is not needed.
+	if err := lsm.rotateNonEmpty(); err != nil {
+		return err
+	}
+	if err := lsm.MinorCompact(); err != nil {
+		return err
+	}
+
+	// wait for the running compaction, and no tables are changed until linked.
+	lsm.compactC <- struct{}{}
+	defer func() { <-lsm.compactC }()
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	if err := lsm.checkpoint(dir); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+	return nil
+}
+
+// checkpoint links the files of column families into dir, and writes the manifest.
+func (lsm *LSM) checkpoint(dir string) error {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	for id, cf := range lsm.cfs {
+		cfDir := columnFamilyDir(dir, id)
+		if err := os.MkdirAll(cfDir, 0755); err != nil {
+			return err
+		}
+		if err := cf.index.Checkpoint(cfDir); err != nil {
+			return err
+		}
+		// persist the links, dir is synced with the manifest.
+		if id != 0 {
+			if err := table.SyncDir(cfDir); err != nil {
+				return err
+			}
+		}
+	}
+	return lsm.saveColumnFamilies(dir)
+}
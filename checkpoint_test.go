@@ -0,0 +1,84 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	dir, ckDir := t.TempDir(), filepath.Join(t.TempDir(), "checkpoint")
+
+	opt := testOption()
+	opt.MinBlobSize = 64
+	lsm, err := NewLSM(dir, opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+
+	const num = 10000
+
+	// level1, level0 and memdb.
+	getBlobValue := func(i, version int) []byte {
+		return []byte(fmt.Sprintf("%0100d-%d", i, version))
+	}
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+	for i := 0; i < num; i += 10 {
+		assert.Nil(users.Put(getKey(i), getBlobValue(i, 0)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.Put(getKey(num), getValue(num, 0)))
+
+	assert.Nil(lsm.Checkpoint(ckDir))
+	assert.ErrorIs(lsm.Checkpoint(ckDir), os.ErrExist)
+
+	// tables are hard linked.
+	tables, _ := filepath.Glob(filepath.Join(ckDir, "*.sst"))
+	assert.Greater(len(tables), 0)
+	for _, path := range tables {
+		src, err := os.Stat(filepath.Join(dir, filepath.Base(path)))
+		assert.Nil(err)
+		dst, err := os.Stat(path)
+		assert.Nil(err)
+		assert.True(os.SameFile(src, dst))
+	}
+	blobs, _ := filepath.Glob(filepath.Join(columnFamilyDir(ckDir, users.ID()), "*.blob"))
+	assert.Greater(len(blobs), 0)
+
+	// the checkpoint is not changed by the writes and compactions after it.
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 1)))
+	}
+	for i := 0; i < num; i += 10 {
+		assert.Nil(users.Put(getKey(i), getBlobValue(i, 1)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+	checkGet(lsm, 0, num, 1, assert)
+
+	ck, err := NewLSM(ckDir, opt)
+	assert.Nil(err)
+	defer ck.Close()
+	checkGet(ck, 0, num+1, 0, assert)
+
+	ckUsers, err := ck.GetColumnFamily("users")
+	assert.Nil(err)
+	for i := 0; i < num; i += 10 {
+		value, err := ckUsers.Get(getKey(i))
+		assert.Nil(err)
+		assert.Equal(getBlobValue(i, 0), value)
+	}
+
+	assert.Nil(lsm.Close())
+	assert.ErrorIs(lsm.Checkpoint(filepath.Join(t.TempDir(), "closed")), ErrClosed)
+}
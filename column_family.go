@@ -0,0 +1,359 @@
+package lsm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/level"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/option"
+	"github.com/xgzlucario/LSM/table"
+)
+
+const (
+	defaultCFName = "default"
+
+	// cfManifestName is the file which records the column families,
+	// format: "next <next id>" and then "<id> <quoted name>" per line.
+	cfManifestName = "COLUMNFAMILY"
+)
+
+var (
+	ErrColumnFamilyExists   = errors.New("lsm: column family already exists")
+	ErrColumnFamilyNotFound = errors.New("lsm: column family not found")
+	ErrDropDefaultCF        = errors.New("lsm: default column family can not be dropped")
+)
+
+// ColumnFamily is a separate keyspace of LSM with its own memdbs, levels and option.
+// Column families share the log, sequence number and background compaction, so that
+// a WriteBatch across column families is atomic. The default column family is stored
+// in the directory of LSM, and the others in sub directories.
+type ColumnFamily struct {
+	lsm  *LSM
+	id   uint32
+	name string
+	opt  *option.Option
+
+	// db is the active memdb and dbList is the immutable memdbs, guarded by lsm.mu.
+	db     *memdb.DB
+	dbList []*memdb.DB
+
+	index *level.Controller
+}
+
+// columnFamilyDir return the directory of column family id in the directory of LSM.
+func columnFamilyDir(dir string, id uint32) string {
+	if id == 0 {
+		return dir
+	}
+	return filepath.Join(dir, fmt.Sprintf("cf-%d", id))
+}
+
+// openColumnFamily opens the column family and builds its levels from disk.
+func (lsm *LSM) openColumnFamily(id uint32, name string, opt *option.Option) (*ColumnFamily, error) {
+	dir := columnFamilyDir(lsm.dir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	cf := &ColumnFamily{
+		lsm:   lsm,
+		id:    id,
+		name:  name,
+		opt:   opt,
+		db:    memdb.New(opt.MemDBSize),
+		index: level.NewController(dir, opt),
+	}
+	if err := cf.index.BuildFromDisk(); err != nil {
+		return nil, err
+	}
+	return cf, nil
+}
+
+// openColumnFamilies opens the column families in manifest, the default one is always opened.
+// the column family is opened with its option in opt.ColumnFamilies if any.
+func (lsm *LSM) openColumnFamilies() error {
+	names := map[uint32]string{0: defaultCFName}
+	lsm.nextCFID = 1
+
+	fd, err := os.Open(filepath.Join(lsm.dir, cfManifestName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		defer fd.Close()
+
+		scanner := bufio.NewScanner(fd)
+		for scanner.Scan() {
+			first, rest, _ := strings.Cut(scanner.Text(), " ")
+			if first == "next" {
+				next, err := strconv.ParseUint(rest, 10, 32)
+				if err != nil {
+					return fmt.Errorf("lsm: invalid column family manifest: %w", err)
+				}
+				lsm.nextCFID = uint32(next)
+				continue
+			}
+			id, err := strconv.ParseUint(first, 10, 32)
+			if err != nil {
+				return fmt.Errorf("lsm: invalid column family manifest: %w", err)
+			}
+			name, err := strconv.Unquote(rest)
+			if err != nil {
+				return fmt.Errorf("lsm: invalid column family manifest: %w", err)
+			}
+			names[uint32(id)] = name
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+
+	for id, name := range names {
+		opt := lsm.Option
+		if cfOpt, ok := lsm.ColumnFamilies[name]; ok && id != 0 {
+			opt = cfOpt
+		}
+		cf, err := lsm.openColumnFamily(id, name, opt)
+		if err != nil {
+			return err
+		}
+		lsm.cfs[id] = cf
+	}
+	lsm.defaultCF = lsm.cfs[0]
+
+	return nil
+}
+
+// saveColumnFamilies rewrites the manifest in dir, lsm.mu must be held.
+func (lsm *LSM) saveColumnFamilies(dir string) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "next %d\n", lsm.nextCFID)
+	for id, cf := range lsm.cfs {
+		if id != 0 {
+			fmt.Fprintf(&sb, "%d %s\n", id, strconv.Quote(cf.name))
+		}
+	}
+
+	// replace the manifest atomically.
+	path := filepath.Join(dir, cfManifestName)
+	fd, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := fd.WriteString(sb.String()); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+	return table.SyncDir(dir)
+}
+
+// CreateColumnFamily creates a column family with option, nil means the option of LSM.
+func (lsm *LSM) CreateColumnFamily(name string, opt *option.Option) (*ColumnFamily, error) {
+	if opt == nil {
+		opt = lsm.Option
+	}
+	if lsm.closed.Load() {
+		return nil, ErrClosed
+	}
+
+	lsm.mu.Lock()
+	defer lsm.mu.Unlock()
+
+	for _, cf := range lsm.cfs {
+		if cf.name == name {
+			return nil, ErrColumnFamilyExists
+		}
+	}
+
+	// ids are never reused, so that the entries of dropped column family in log are skipped.
+	cf, err := lsm.openColumnFamily(lsm.nextCFID, name, opt)
+	if err != nil {
+		return nil, err
+	}
+	lsm.cfs[cf.id] = cf
+	lsm.nextCFID++
+
+	if err := lsm.saveColumnFamilies(lsm.dir); err != nil {
+		// the column family is not in manifest, remove it.
+		delete(lsm.cfs, cf.id)
+		cf.index.Close()
+		os.RemoveAll(columnFamilyDir(lsm.dir, cf.id))
+		return nil, err
+	}
+	return cf, nil
+}
+
+// DropColumnFamily drops the column family and removes its data, the concurrent reads of it
+// return ErrColumnFamilyNotFound, and the opened iterators of it are still valid until closed.
+func (lsm *LSM) DropColumnFamily(cf *ColumnFamily) error {
+	if cf.ID() == 0 {
+		return ErrDropDefaultCF
+	}
+
+	// wait for the running compaction.
+	lsm.compactC <- struct{}{}
+	defer func() { <-lsm.compactC }()
+
+	lsm.mu.Lock()
+	if lsm.cfs[cf.id] != cf {
+		lsm.mu.Unlock()
+		return ErrColumnFamilyNotFound
+	}
+	delete(lsm.cfs, cf.id)
+	err := lsm.saveColumnFamilies(lsm.dir)
+	if err != nil {
+		lsm.cfs[cf.id] = cf
+	}
+	lsm.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	// the concurrent reads of cf find it dropped after reading the levels.
+	cf.index.Drop()
+	return os.RemoveAll(columnFamilyDir(lsm.dir, cf.id))
+}
+
+// dropped return true if cf is dropped.
+func (cf *ColumnFamily) dropped() bool {
+	cf.lsm.mu.RLock()
+	defer cf.lsm.mu.RUnlock()
+	return cf.lsm.cfs[cf.id] != cf
+}
+
+// GetColumnFamily return the column family by name.
+func (lsm *LSM) GetColumnFamily(name string) (*ColumnFamily, error) {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	for _, cf := range lsm.cfs {
+		if cf.name == name {
+			return cf, nil
+		}
+	}
+	return nil, ErrColumnFamilyNotFound
+}
+
+// DefaultColumnFamily
+func (lsm *LSM) DefaultColumnFamily() *ColumnFamily {
+	return lsm.defaultCF
+}
+
+// columnFamilies return the column families ordered by id.
+func (lsm *LSM) columnFamilies() []*ColumnFamily {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	cfs := make([]*ColumnFamily, 0, len(lsm.cfs))
+	for _, cf := range lsm.cfs {
+		cfs = append(cfs, cf)
+	}
+	slices.SortFunc(cfs, func(a, b *ColumnFamily) int { return int(a.id) - int(b.id) })
+	return cfs
+}
+
+// ID return the id of column family, nil is the default column family.
+func (cf *ColumnFamily) ID() uint32 {
+	if cf == nil {
+		return 0
+	}
+	return cf.id
+}
+
+// Name
+func (cf *ColumnFamily) Name() string {
+	return cf.name
+}
+
+// Get find value by key in column family.
+func (cf *ColumnFamily) Get(key []byte) ([]byte, error) {
+	return cf.get(key, cf.lsm.seq.Load())
+}
+
+// MultiGet is Get of keys in column family.
+func (cf *ColumnFamily) MultiGet(keys [][]byte) ([][]byte, []error) {
+	return cf.multiGet(keys, cf.lsm.seq.Load(), nil)
+}
+
+// Put
+func (cf *ColumnFamily) Put(key, value []byte) error {
+	var batch WriteBatch
+	batch.PutCF(cf, key, value)
+	return cf.lsm.Write(&batch)
+}
+
+// PutWithTTL
+func (cf *ColumnFamily) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	var batch WriteBatch
+	batch.PutWithTTLCF(cf, key, value, ttl)
+	return cf.lsm.Write(&batch)
+}
+
+// Delete
+func (cf *ColumnFamily) Delete(key []byte) error {
+	var batch WriteBatch
+	batch.DeleteCF(cf, key)
+	return cf.lsm.Write(&batch)
+}
+
+// DeleteRange
+func (cf *ColumnFamily) DeleteRange(start, end []byte) error {
+	var batch WriteBatch
+	batch.DeleteRangeCF(cf, start, end)
+	return cf.lsm.Write(&batch)
+}
+
+// Merge
+func (cf *ColumnFamily) Merge(key, operand []byte) error {
+	var batch WriteBatch
+	batch.MergeCF(cf, key, operand)
+	return cf.lsm.Write(&batch)
+}
+
+// NewIterator
+func (cf *ColumnFamily) NewIterator(opts *IterOptions) *Iterator {
+	return cf.lsm.newIterator(cf, cf.lsm.seq.Load(), opts)
+}
+
+// batchSizes return the max size of memdb taken by batch in each column family.
+// ErrColumnFamilyNotFound is returned if any column family is dropped, and
+// ErrNoMergeOperator if any merge operand is written to column family without merge operator.
+// lsm.mu must be held.
+func (lsm *LSM) batchSizes(batch *WriteBatch) (map[*ColumnFamily]uint32, error) {
+	sizes := make(map[*ColumnFamily]uint32, 1)
+	var err error
+	iterErr := batch.iter(func(id uint32, key, value []byte, kind ikey.Kind) {
+		cf := lsm.cfs[id]
+		if cf == nil {
+			err = ErrColumnFamilyNotFound
+			return
+		}
+		if kind == ikey.KindMerge && cf.opt.MergeOperator == nil && err == nil {
+			err = ErrNoMergeOperator
+		}
+		sizes[cf] += memdb.EntrySize(key, value)
+	})
+	if iterErr != nil {
+		return nil, iterErr
+	}
+	return sizes, err
+}
@@ -0,0 +1,309 @@
+package lsm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/option"
+)
+
+func TestColumnFamily(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opt := testOption()
+
+	counterOpt := *opt
+	counterOpt.DataBlockSize = 4 * option.KB
+	counterOpt.MergeOperator = addOperator{}
+	opt.ColumnFamilies = map[string]*option.Option{"counter": &counterOpt}
+
+	lsm, err := NewLSM(dir, opt)
+	assert.Nil(err)
+
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+	counter, err := lsm.CreateColumnFamily("counter", &counterOpt)
+	assert.Nil(err)
+	_, err = lsm.CreateColumnFamily("users", nil)
+	assert.ErrorIs(err, ErrColumnFamilyExists)
+	assert.ErrorIs(lsm.DropColumnFamily(lsm.DefaultColumnFamily()), ErrDropDefaultCF)
+
+	const num = 1000
+
+	// the same keys in different column families, written by atomic batches.
+	for i := 0; i < num; i++ {
+		var batch WriteBatch
+		batch.Put(getKey(i), getValue(i, 0))
+		batch.PutCF(users, getKey(i), getValue(i, 1))
+		batch.MergeCF(counter, getKey(i%10), []byte("1"))
+		assert.Nil(lsm.Write(&batch))
+	}
+	assert.ErrorIs(lsm.Merge(getKey(0), []byte("1")), ErrNoMergeOperator)
+
+	checkData := func() {
+		checkGet(lsm, 0, num, 0, assert)
+		for i := 0; i < num; i++ {
+			value, err := users.Get(getKey(i))
+			assert.Nil(err)
+			assert.Equal(getValue(i, 1), value)
+		}
+		for i := 0; i < 10; i++ {
+			value, err := counter.Get(getKey(i))
+			assert.Nil(err)
+			assert.Equal(strconv.Itoa(num/10), string(value))
+		}
+		_, err := counter.Get(getKey(10))
+		assert.ErrorIs(err, ErrKeyNotFound)
+
+		it := users.NewIterator(nil)
+		var count int
+		for it.First(); it.Valid(); it.Next() {
+			count++
+		}
+		assert.Nil(it.Close())
+		assert.Equal(num, count)
+	}
+	checkData()
+
+	// replayed from log.
+	lsm.cancel()
+	lsm, err = NewLSM(dir, opt)
+	assert.Nil(err)
+	users, err = lsm.GetColumnFamily("users")
+	assert.Nil(err)
+	counter, _ = lsm.GetColumnFamily("counter")
+	checkData()
+
+	// dumped and compacted in their own levels.
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+	checkData()
+	logs, _ := filepath.Glob(filepath.Join(dir, "*"+logExt))
+	assert.Equal(1, len(logs))
+
+	lsm.Close()
+	lsm, err = NewLSM(dir, opt)
+	assert.Nil(err)
+	defer lsm.Close()
+	users, _ = lsm.GetColumnFamily("users")
+	counter, _ = lsm.GetColumnFamily("counter")
+	checkData()
+
+	// drop.
+	assert.Nil(users.Delete(getKey(0)))
+	assert.Nil(lsm.DropColumnFamily(users))
+	assert.ErrorIs(lsm.DropColumnFamily(users), ErrColumnFamilyNotFound)
+	assert.ErrorIs(users.Put(getKey(0), nil), ErrColumnFamilyNotFound)
+	_, err = users.Get(getKey(1))
+	assert.ErrorIs(err, ErrColumnFamilyNotFound)
+	_, err = os.Stat(filepath.Join(dir, "cf-1"))
+	assert.True(os.IsNotExist(err))
+
+	// the id of dropped column family is not reused, and its entries in log are skipped.
+	users, err = lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+	assert.Equal(uint32(3), users.ID())
+	lsm.cancel()
+
+	lsm, err = NewLSM(dir, opt)
+	assert.Nil(err)
+	users, _ = lsm.GetColumnFamily("users")
+	for i := 0; i < num; i++ {
+		_, err := users.Get(getKey(i))
+		assert.ErrorIs(err, ErrKeyNotFound)
+	}
+	checkGet(lsm, 0, num, 0, assert)
+}
+
+func TestColumnFamilyCompression(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opt := testOption()
+
+	rawOpt := *opt
+	rawOpt.Compression = option.NoCompression
+	opt.ColumnFamilies = map[string]*option.Option{"raw": &rawOpt}
+
+	lsm, err := NewLSM(dir, opt)
+	assert.Nil(err)
+	raw, err := lsm.CreateColumnFamily("raw", &rawOpt)
+	assert.Nil(err)
+
+	const num = 1000
+	value := []byte(strings.Repeat("a", 100))
+	for i := 0; i < num; i++ {
+		var batch WriteBatch
+		batch.Put(getKey(i), value)
+		batch.PutCF(raw, getKey(i), value)
+		assert.Nil(lsm.Write(&batch))
+	}
+	assert.Nil(lsm.Flush(true))
+
+	// the same entries take more space without compression.
+	size := func(cf *ColumnFamily) int64 {
+		paths, _ := filepath.Glob(filepath.Join(columnFamilyDir(dir, cf.ID()), "*.sst"))
+		var size int64
+		for _, path := range paths {
+			fi, err := os.Stat(path)
+			assert.Nil(err)
+			size += fi.Size()
+		}
+		return size
+	}
+	assert.Greater(size(raw), 2*size(lsm.DefaultColumnFamily()))
+	lsm.Close()
+
+	// the tables are readable with the other compression.
+	opt.ColumnFamilies = nil
+	lsm, err = NewLSM(dir, opt)
+	assert.Nil(err)
+	defer lsm.Close()
+	raw, _ = lsm.GetColumnFamily("raw")
+	for i := 0; i < num; i++ {
+		v, err := raw.Get(getKey(i))
+		assert.Nil(err)
+		assert.Equal(value, v)
+	}
+}
+
+func TestColumnFamilyFIFO(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opt := testOption()
+
+	logsOpt := *opt
+	logsOpt.CompactionStyle = option.FIFOCompaction
+	opt.ColumnFamilies = map[string]*option.Option{"logs": &logsOpt}
+
+	lsm, err := NewLSM(dir, opt)
+	assert.Nil(err)
+	logs, err := lsm.CreateColumnFamily("logs", &logsOpt)
+	assert.Nil(err)
+
+	// each round is dumped into a level0 table of the same size.
+	const num, rounds = 1000, 5
+	for r := 0; r < rounds; r++ {
+		for i := r * num; i < (r+1)*num; i++ {
+			var batch WriteBatch
+			batch.Put(getKey(i), getValue(i, 0))
+			batch.PutCF(logs, getKey(i), getValue(i, 0))
+			assert.Nil(lsm.Write(&batch))
+		}
+		assert.Nil(lsm.Flush(true))
+	}
+	assert.Equal(rounds, logs.index.NumLevel0Tables())
+
+	// no limit, nothing is dropped.
+	assert.Nil(lsm.MajorCompact())
+	assert.Equal(rounds, logs.index.NumLevel0Tables())
+	assert.Equal(0, lsm.defaultCF.index.NumLevel0Tables())
+
+	// keep the newest 2 tables.
+	size, _ := logs.index.Approximate(nil, nil)
+	logsOpt.FIFOMaxTableSize = size * 2 / rounds
+	assert.True(logs.index.CompactionPending())
+	assert.Nil(lsm.MajorCompact())
+	assert.Equal(2, logs.index.NumLevel0Tables())
+	assert.False(logs.index.CompactionPending())
+
+	for i := 0; i < rounds*num; i++ {
+		value, err := logs.Get(getKey(i))
+		if i < (rounds-2)*num {
+			assert.ErrorIs(err, ErrKeyNotFound)
+		} else {
+			assert.Nil(err)
+			assert.Equal(getValue(i, 0), value)
+		}
+	}
+	checkGet(lsm, 0, rounds*num, 0, assert)
+	assert.Nil(lsm.Close())
+
+	// the tables dropped are removed from disk.
+	lsm, err = NewLSM(dir, opt)
+	assert.Nil(err)
+	logs, err = lsm.GetColumnFamily("logs")
+	assert.Nil(err)
+	assert.Equal(2, logs.index.NumLevel0Tables())
+	assert.Nil(lsm.Close())
+}
+
+func TestCreateColumnFamilyError(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	lsm, err := NewLSM(dir, testOption())
+	assert.Nil(err)
+	defer lsm.Close()
+
+	// the manifest can not be written.
+	tmp := filepath.Join(dir, cfManifestName+".tmp")
+	assert.Nil(os.MkdirAll(filepath.Join(tmp, "x"), 0755))
+
+	_, err = lsm.CreateColumnFamily("users", nil)
+	assert.NotNil(err)
+	_, err = os.Stat(columnFamilyDir(dir, 1))
+	assert.True(os.IsNotExist(err))
+	_, err = lsm.GetColumnFamily("users")
+	assert.ErrorIs(err, ErrColumnFamilyNotFound)
+
+	assert.Nil(os.RemoveAll(tmp))
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+	assert.Nil(users.Put(getKey(0), getValue(0, 0)))
+}
+
+func TestDropColumnFamilyConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+	orders, err := lsm.CreateColumnFamily("orders", nil)
+	assert.Nil(err)
+	const num = 1000
+	for i := 0; i < num; i++ {
+		var batch WriteBatch
+		batch.PutCF(users, getKey(i), getValue(i, 0))
+		batch.PutCF(orders, getKey(i), getValue(i, 0))
+		assert.Nil(lsm.Write(&batch))
+	}
+	assert.Nil(lsm.Flush(true))
+
+	// the tables are kept until the iterator is closed.
+	it := orders.NewIterator(nil)
+	assert.Nil(lsm.DropColumnFamily(orders))
+	var count int
+	for it.First(); it.Valid(); it.Next() {
+		count++
+	}
+	assert.Nil(it.Close())
+	assert.Equal(num, count)
+
+	// the reads racing with drop find the column family dropped.
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i = (i + 1) % num {
+				value, err := users.Get(getKey(i))
+				if errors.Is(err, ErrColumnFamilyNotFound) {
+					return
+				}
+				assert.Nil(err)
+				assert.Equal(getValue(i, 0), value)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(lsm.DropColumnFamily(users))
+	wg.Wait()
+}
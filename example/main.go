@@ -16,7 +16,9 @@ func main() {
 
 	for {
 		k := []byte(gofakeit.Phone())
-		lsm.Put(k, k)
+		if err := lsm.Put(k, k); err != nil {
+			panic(err)
+		}
 
 		time.Sleep(time.Microsecond / 10)
 	}
@@ -0,0 +1,154 @@
+// Package ikey is the internal key of LSM-Tree, which is made up of
+// user key, sequence number and kind.
+package ikey
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Kind is the type of entry.
+type Kind uint8
+
+const (
+	KindVal Kind = 1
+	KindDel Kind = 2 // tombstone
+
+	// KindRangeDel is the range tombstone in write batch, whose key is the start and value is the end.
+	// it is never used in internal key.
+	KindRangeDel Kind = 3
+
+	// KindMerge is the operand of merge operator.
+	KindMerge Kind = 4
+
+	// KindExpire is the value with expiry in write batch, whose value is prefixed by
+	// the expiry unix nano timestamp (8 bytes). it is never used in internal key.
+	KindExpire Kind = 5
+
+	// KindBlob is the value stored in blob file, whose value is the pointer to it.
+	// it is only used in sstables.
+	KindBlob Kind = 6
+
+	// KindSeek is the max kind, which is used to make a key for seeking,
+	// so that it is ordered before all entries with the same sequence.
+	KindSeek Kind = 0xff
+)
+
+const (
+	// MaxSeq is the max sequence number.
+	MaxSeq = 1<<56 - 1
+
+	trailerSize = 8
+
+	// the user key is terminated by 0x00 0x01, and 0x00 in user key is escaped to 0x00 0xff.
+	terminatorSize = 2
+	escape         = 0xff
+	terminator     = 0x01
+)
+
+// Key is the internal key.
+// It is memcomparable, keys are sorted by user key in ascending order and
+// then by sequence number in descending order with bytes.Compare.
+//
+// format: escaped user key + 0x00 0x01 + ^(seq << 8 | kind) (8 bytes, big endian).
+type Key []byte
+
+// Size return the length of internal key made by the user key.
+func Size(userKey []byte) int {
+	return len(userKey) + bytes.Count(userKey, []byte{0}) + terminatorSize + trailerSize
+}
+
+// Make
+func Make(userKey []byte, seq uint64, kind Kind) Key {
+	return Append(make([]byte, 0, Size(userKey)), userKey, seq, kind)
+}
+
+// Append appends the internal key to dst.
+func Append(dst, userKey []byte, seq uint64, kind Kind) Key {
+	for {
+		i := bytes.IndexByte(userKey, 0)
+		if i < 0 {
+			break
+		}
+		dst = append(dst, userKey[:i+1]...)
+		dst = append(dst, escape)
+		userKey = userKey[i+1:]
+	}
+	dst = append(dst, userKey...)
+	dst = append(dst, 0, terminator)
+
+	return binary.BigEndian.AppendUint64(dst, ^(seq<<8 | uint64(kind)))
+}
+
+// Valid return true if k is a well-formed internal key.
+func (k Key) Valid() bool {
+	if len(k) < terminatorSize+trailerSize {
+		return false
+	}
+	escaped := k.escapedUserKey()
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] == 0 {
+			if i+1 == len(escaped) || escaped[i+1] != escape {
+				return false
+			}
+			i++
+		}
+	}
+	return k[len(escaped)] == 0 && k[len(escaped)+1] == terminator
+}
+
+// UserKey return the user key, it refers to k if there is no 0x00 in user key.
+func (k Key) UserKey() []byte {
+	escaped := k.escapedUserKey()
+	if bytes.IndexByte(escaped, 0) < 0 {
+		return escaped[:len(escaped):len(escaped)]
+	}
+
+	userKey := make([]byte, 0, len(escaped))
+	for i := 0; i < len(escaped); i++ {
+		userKey = append(userKey, escaped[i])
+		if escaped[i] == 0 {
+			i++
+		}
+	}
+	return userKey
+}
+
+// Seq return the sequence number.
+func (k Key) Seq() uint64 {
+	return k.trailer() >> 8
+}
+
+// Kind
+func (k Key) Kind() Kind {
+	return Kind(k.trailer())
+}
+
+// SameUserKey return true if k and other have the same user key.
+func (k Key) SameUserKey(other Key) bool {
+	return bytes.Equal(k[:len(k)-trailerSize], other[:len(other)-trailerSize])
+}
+
+// CompareUserKey compares the user keys of k and other.
+func (k Key) CompareUserKey(other Key) int {
+	return bytes.Compare(k[:len(k)-trailerSize], other[:len(other)-trailerSize])
+}
+
+// String
+func (k Key) String() string {
+	if !k.Valid() {
+		return fmt.Sprintf("invalid:%x", []byte(k))
+	}
+	return fmt.Sprintf("%s@%d#%d", k.UserKey(), k.Seq(), k.Kind())
+}
+
+// escapedUserKey
+func (k Key) escapedUserKey() []byte {
+	return k[:len(k)-trailerSize-terminatorSize]
+}
+
+// trailer
+func (k Key) trailer() uint64 {
+	return ^binary.BigEndian.Uint64(k[len(k)-trailerSize:])
+}
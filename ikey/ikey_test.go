@@ -0,0 +1,69 @@
+package ikey
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKey(t *testing.T) {
+	assert := assert.New(t)
+
+	userKeys := [][]byte{
+		{}, {0}, {0, 0}, {0, 1}, {0, 0xff}, {1}, {1, 0}, {1, 0, 0}, {0xff}, {0xff, 0},
+		[]byte("a"), []byte("a\x00b"), []byte("ab"), []byte("abc"), []byte("b"),
+	}
+	seqs := []uint64{0, 1, 2, 255, 256, 1 << 32, MaxSeq}
+	kinds := []Kind{KindVal, KindDel, KindSeek}
+
+	var keys []Key
+	for _, userKey := range userKeys {
+		for _, seq := range seqs {
+			for _, kind := range kinds {
+				k := Make(userKey, seq, kind)
+				assert.True(k.Valid())
+				assert.Equal(Size(userKey), len(k))
+				assert.Equal(userKey, k.UserKey())
+				assert.Equal(seq, k.Seq())
+				assert.Equal(kind, k.Kind())
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	// sorted by user key asc, then seq desc and kind desc.
+	sorted := slices.Clone(keys)
+	rand.Shuffle(len(sorted), func(i, j int) {
+		sorted[i], sorted[j] = sorted[j], sorted[i]
+	})
+	slices.SortFunc(sorted, func(a, b Key) int {
+		return bytes.Compare(a, b)
+	})
+	for i := 1; i < len(sorted); i++ {
+		a, b := sorted[i-1], sorted[i]
+		cmp := bytes.Compare(a.UserKey(), b.UserKey())
+		assert.LessOrEqual(cmp, 0)
+		assert.Equal(cmp, a.CompareUserKey(b))
+
+		if cmp == 0 {
+			assert.True(a.SameUserKey(b))
+			assert.True(a.Seq() > b.Seq() || (a.Seq() == b.Seq() && a.Kind() > b.Kind()))
+		} else {
+			assert.False(a.SameUserKey(b))
+		}
+	}
+
+	// append.
+	k := Append([]byte("prefix"), []byte("a\x00b"), 10, KindDel)
+	assert.Equal(Make([]byte("a\x00b"), 10, KindDel), k[6:])
+
+	// invalid.
+	assert.False(Key(nil).Valid())
+	assert.False(Key([]byte("a\x00b\x00\x01")).Valid())
+	k2 := Make([]byte("a"), 1, KindVal)
+	assert.False(k2[:len(k2)-1].Valid())
+	assert.Equal("a\x00b@10#2", k[6:].String())
+}
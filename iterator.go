@@ -0,0 +1,371 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/iterator"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/option"
+	"github.com/xgzlucario/LSM/rangedel"
+)
+
+// IterOptions is the options of Iterator, nil means the default options.
+type IterOptions struct {
+	// LowerBound is the inclusive lower bound of user keys, nil means unbounded.
+	LowerBound []byte
+
+	// UpperBound is the exclusive upper bound of user keys, nil means unbounded.
+	UpperBound []byte
+}
+
+// Iterator iterates user keys of LSM in order, as of the moment it is created.
+// Shadowed versions, deleted and expired keys are hidden, and merge operands are merged.
+// Key and Value are only valid until the next move, and it must be closed after use.
+type Iterator struct {
+	iter  iterator.Iterator
+	seq   uint64
+	now   int64 // entries expired before now are hidden.
+	valid bool
+
+	// bounds in internal key, the smallest internal keys of the bound user keys.
+	lower ikey.Key
+	upper ikey.Key
+
+	// rangeDels is the fragments of range tombstones of memdbs and tables.
+	rangeDels rangedel.Set
+
+	merger   option.MergeOperator
+	operands [][]byte
+	err      error
+
+	// in reverse direction, iter is positioned before the entries of current key,
+	// and the current entry is saved.
+	reverse    bool
+	savedKey   ikey.Key
+	savedValue []byte
+
+	// in forward direction, iter is positioned after the merged entries of current key,
+	// and the merged value is saved.
+	merged bool
+}
+
+// NewIterator
+func (lsm *LSM) NewIterator(opts *IterOptions) *Iterator {
+	return lsm.newIterator(lsm.defaultCF, lsm.seq.Load(), opts)
+}
+
+// newIterator return an iterator of column family which sees the versions
+// whose sequence number is not greater than seq.
+func (lsm *LSM) newIterator(cf *ColumnFamily, seq uint64, opts *IterOptions) *Iterator {
+	it := &Iterator{seq: seq, now: time.Now().UnixNano(), merger: cf.opt.MergeOperator}
+	if opts != nil && opts.LowerBound != nil {
+		it.lower = ikey.Make(opts.LowerBound, ikey.MaxSeq, ikey.KindSeek)
+	}
+	if opts != nil && opts.UpperBound != nil {
+		it.upper = ikey.Make(opts.UpperBound, ikey.MaxSeq, ikey.KindSeek)
+	}
+
+	if lsm.closed.Load() {
+		it.iter, it.err = iterator.NewMergingIterator(), ErrClosed
+		return it
+	}
+
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	// memdbs from newest to oldest, and then tables.
+	dbs := []*memdb.DB{cf.db}
+	for i := len(cf.dbList) - 1; i >= 0; i-- {
+		dbs = append(dbs, cf.dbList[i])
+	}
+	var iters []iterator.Iterator
+	var rangeDels rangedel.Set
+	for _, db := range dbs {
+		iters = append(iters, db.NewIterator())
+		if frags := db.Fragments(); len(frags) > 0 {
+			rangeDels = append(rangeDels, frags)
+		}
+	}
+	tableIters, tableRangeDels := cf.index.NewIterators(it.lower, it.upper)
+	iters = append(iters, tableIters...)
+	rangeDels = append(rangeDels, tableRangeDels...)
+
+	it.iter = iterator.NewMergingIterator(iters...)
+	it.rangeDels = rangeDels
+
+	return it
+}
+
+// NewIterator return an iterator as of the snapshot.
+func (s *Snapshot) NewIterator(opts *IterOptions) *Iterator {
+	return s.lsm.newIterator(s.lsm.defaultCF, s.seq, opts)
+}
+
+// NewIteratorCF return an iterator of column family as of the snapshot.
+func (s *Snapshot) NewIteratorCF(cf *ColumnFamily, opts *IterOptions) *Iterator {
+	return s.lsm.newIterator(cf, s.seq, opts)
+}
+
+// First
+func (it *Iterator) First() {
+	it.reverse, it.merged = false, false
+	it.seekFirst()
+	it.findNextUserEntry(false)
+}
+
+// Last
+func (it *Iterator) Last() {
+	it.reverse, it.merged = true, false
+	if it.upper != nil {
+		it.seekBefore(it.upper)
+	} else {
+		it.iter.Last()
+	}
+	it.findPrevUserEntry()
+}
+
+// Seek moves to the first key which is greater than or equal to key.
+func (it *Iterator) Seek(key []byte) {
+	it.reverse, it.merged = false, false
+	target := ikey.Make(key, it.seq, ikey.KindSeek)
+	if it.lower != nil && bytes.Compare(target, it.lower) < 0 {
+		target = it.lower
+	}
+	it.iter.Seek(target)
+	it.findNextUserEntry(false)
+}
+
+// SeekForPrev moves to the last key which is less than or equal to key.
+func (it *Iterator) SeekForPrev(key []byte) {
+	it.reverse, it.merged = true, false
+	// the largest internal key of user key.
+	target := ikey.Make(key, 0, 0)
+	if it.upper != nil && bytes.Compare(target, it.upper) > 0 {
+		target = it.upper
+	}
+	it.seekBefore(target)
+	it.findPrevUserEntry()
+}
+
+// Next
+func (it *Iterator) Next() {
+	if it.reverse {
+		// move to the entries of current key.
+		if it.iter.Valid() {
+			it.iter.Next()
+		} else {
+			it.seekFirst()
+		}
+		it.reverse = false
+	} else if !it.merged {
+		it.savedKey = append(it.savedKey[:0], it.iter.Key()...)
+		it.iter.Next()
+	}
+	it.merged = false
+
+	// skip the older versions of current key.
+	it.findNextUserEntry(true)
+}
+
+// Prev
+func (it *Iterator) Prev() {
+	if !it.reverse {
+		// move before the entries of current key, iter is after them if merged.
+		if !it.merged {
+			it.savedKey = append(it.savedKey[:0], it.iter.Key()...)
+		}
+		if it.iter.Valid() {
+			it.iter.Prev()
+		} else {
+			it.iter.Last()
+		}
+		for it.iter.Valid() && it.iter.Key().CompareUserKey(it.savedKey) >= 0 {
+			it.iter.Prev()
+		}
+		it.reverse, it.merged = true, false
+	}
+	it.findPrevUserEntry()
+}
+
+// Valid
+func (it *Iterator) Valid() bool {
+	return it.valid && it.err == nil && it.iter.Error() == nil
+}
+
+// Key
+func (it *Iterator) Key() []byte {
+	if it.reverse || it.merged {
+		return it.savedKey.UserKey()
+	}
+	return it.iter.Key().UserKey()
+}
+
+// Value
+func (it *Iterator) Value() []byte {
+	if it.reverse || it.merged {
+		return it.savedValue
+	}
+	return it.iter.Value()
+}
+
+// Close return the error met during iteration.
+func (it *Iterator) Close() error {
+	it.valid = false
+	return errors.Join(it.err, it.iter.Close())
+}
+
+// seekFirst moves iter to the first entry not less than the lower bound.
+func (it *Iterator) seekFirst() {
+	if it.lower != nil {
+		it.iter.Seek(it.lower)
+	} else {
+		it.iter.First()
+	}
+}
+
+// seekBefore moves iter to the last entry less than key.
+func (it *Iterator) seekBefore(key ikey.Key) {
+	it.iter.Seek(key)
+	if it.iter.Valid() {
+		it.iter.Prev()
+	} else {
+		it.iter.Last()
+	}
+}
+
+// findNextUserEntry moves forward to the newest visible value of the next user key,
+// entries of savedKey are skipped if skipping is true.
+func (it *Iterator) findNextUserEntry(skipping bool) {
+	for ; it.iter.Valid(); it.iter.Next() {
+		key := it.iter.Key()
+		if it.upper != nil && bytes.Compare(key, it.upper) >= 0 {
+			break
+		}
+		if key.Seq() > it.seq {
+			continue
+		}
+		switch it.kind(key) {
+		case ikey.KindDel:
+			// hide the older versions of the deleted key.
+			it.savedKey = append(it.savedKey[:0], key...)
+			skipping = true
+
+		case ikey.KindVal:
+			if skipping && key.SameUserKey(it.savedKey) {
+				continue
+			}
+			it.valid = true
+			return
+
+		case ikey.KindMerge:
+			if skipping && key.SameUserKey(it.savedKey) {
+				continue
+			}
+			it.mergeForward()
+			it.valid = true
+			return
+		}
+	}
+	it.valid = false
+}
+
+// mergeForward merges the operands from the current entry to the older entries of the same user key,
+// iter is moved after the merged entries.
+func (it *Iterator) mergeForward() {
+	it.savedKey = append(it.savedKey[:0], it.iter.Key()...)
+	it.operands = append(it.operands[:0], slices.Clone(it.iter.Value()))
+
+	var existing []byte
+	for it.iter.Next(); it.iter.Valid() && it.iter.Key().SameUserKey(it.savedKey); it.iter.Next() {
+		kind := it.kind(it.iter.Key())
+		if kind == ikey.KindVal {
+			existing = append([]byte{}, it.iter.Value()...)
+			break
+		}
+		if kind == ikey.KindDel {
+			break
+		}
+		it.operands = append(it.operands, slices.Clone(it.iter.Value()))
+	}
+
+	// operands are collected from newer to older.
+	slices.Reverse(it.operands)
+	it.savedValue = it.merge(existing)
+	it.merged = true
+}
+
+// findPrevUserEntry moves backward to the entries before the previous user key,
+// whose newest visible value is saved.
+func (it *Iterator) findPrevUserEntry() {
+	kind := ikey.KindDel
+	hasBase := false
+	it.operands = it.operands[:0]
+
+	for ; it.iter.Valid(); it.iter.Prev() {
+		key := it.iter.Key()
+		if it.lower != nil && bytes.Compare(key, it.lower) < 0 {
+			break
+		}
+		// entries beyond the upper bound may be left by the pruned tables.
+		if key.Seq() > it.seq || it.upper != nil && bytes.Compare(key, it.upper) >= 0 {
+			continue
+		}
+		// the value of savedKey is found when reaching a smaller user key.
+		if kind != ikey.KindDel && key.CompareUserKey(it.savedKey) < 0 {
+			break
+		}
+
+		// entries are visited from older to newer.
+		switch kind = it.kind(key); kind {
+		case ikey.KindDel:
+			it.savedKey = it.savedKey[:0]
+			it.savedValue = it.savedValue[:0]
+			it.operands = it.operands[:0]
+			hasBase = false
+
+		case ikey.KindVal:
+			it.savedKey = append(it.savedKey[:0], key...)
+			it.savedValue = append(it.savedValue[:0], it.iter.Value()...)
+			it.operands = it.operands[:0]
+			hasBase = true
+
+		case ikey.KindMerge:
+			// savedValue is kept as the existing value.
+			it.savedKey = append(it.savedKey[:0], key...)
+			it.operands = append(it.operands, slices.Clone(it.iter.Value()))
+		}
+	}
+
+	if kind == ikey.KindMerge {
+		var existing []byte
+		if hasBase {
+			existing = append([]byte{}, it.savedValue...)
+		}
+		it.savedValue = it.merge(existing)
+	}
+	it.valid = kind != ikey.KindDel
+}
+
+// merge merges operands into existing value of savedKey.
+func (it *Iterator) merge(existing []byte) []byte {
+	if it.merger == nil {
+		it.err = ErrNoMergeOperator
+		return nil
+	}
+	return it.merger.Merge(it.savedKey.UserKey(), existing, it.operands)
+}
+
+// kind return KindDel if the current entry is deleted by a range tombstone or expired.
+func (it *Iterator) kind(key ikey.Key) ikey.Kind {
+	if len(it.rangeDels) > 0 && key.Seq() < it.rangeDels.MaxSeq(key.UserKey(), it.seq) {
+		return ikey.KindDel
+	}
+	if expire := it.iter.Expire(); expire != 0 && expire <= it.now {
+		return ikey.KindDel
+	}
+	return key.Kind()
+}
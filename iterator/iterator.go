@@ -0,0 +1,199 @@
+// Package iterator is the internal iterator of LSM-Tree,
+// which iterates entries in the order of internal key.
+package iterator
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/xgzlucario/LSM/ikey"
+)
+
+// Iterator is implemented by memdb, table, level and merging iterator.
+// Key and Value are only valid until the next move.
+type Iterator interface {
+	// First moves to the first entry.
+	First()
+
+	// Last moves to the last entry.
+	Last()
+
+	// Seek moves to the first entry whose key is greater than or equal to key.
+	Seek(key ikey.Key)
+
+	Next()
+
+	Prev()
+
+	Valid() bool
+
+	Key() ikey.Key
+
+	Value() []byte
+
+	// Expire return the expiry unix nano timestamp of entry, 0 means never.
+	Expire() int64
+
+	// Error return the error met during iteration, the iterator is invalid if not nil.
+	Error() error
+
+	Close() error
+}
+
+// mergingIterator merges iterators into one.
+type mergingIterator struct {
+	iters   []Iterator
+	cur     Iterator
+	reverse bool
+}
+
+// NewMergingIterator return an iterator which merges iters,
+// for the same key, the entry of the former iterator comes first.
+// the entries with the same internal key in different iters are the same entry,
+// e.g. of a memdb being dumped and its table, so only one of them is returned.
+func NewMergingIterator(iters ...Iterator) Iterator {
+	return &mergingIterator{iters: iters}
+}
+
+// First
+func (m *mergingIterator) First() {
+	for _, it := range m.iters {
+		it.First()
+	}
+	m.findSmallest()
+	m.reverse = false
+}
+
+// Last
+func (m *mergingIterator) Last() {
+	for _, it := range m.iters {
+		it.Last()
+	}
+	m.findLargest()
+	m.reverse = true
+}
+
+// Seek
+func (m *mergingIterator) Seek(key ikey.Key) {
+	for _, it := range m.iters {
+		it.Seek(key)
+	}
+	m.findSmallest()
+	m.reverse = false
+}
+
+// Next
+func (m *mergingIterator) Next() {
+	// make sure all other iterators are positioned after the current key.
+	if m.reverse {
+		key := m.cur.Key()
+		for _, it := range m.iters {
+			if it == m.cur {
+				continue
+			}
+			it.Seek(key)
+			if it.Valid() && bytes.Equal(it.Key(), key) {
+				it.Next()
+			}
+		}
+		m.reverse = false
+	}
+	m.cur.Next()
+	m.findSmallest()
+}
+
+// Prev
+func (m *mergingIterator) Prev() {
+	// make sure all other iterators are positioned before the current key.
+	if !m.reverse {
+		key := m.cur.Key()
+		for _, it := range m.iters {
+			if it == m.cur {
+				continue
+			}
+			it.Seek(key)
+			if it.Valid() {
+				it.Prev()
+			} else {
+				it.Last()
+			}
+		}
+		m.reverse = true
+	}
+	m.cur.Prev()
+	m.findLargest()
+}
+
+// Valid
+func (m *mergingIterator) Valid() bool {
+	return m.cur != nil && m.cur.Valid()
+}
+
+// Key
+func (m *mergingIterator) Key() ikey.Key {
+	return m.cur.Key()
+}
+
+// Value
+func (m *mergingIterator) Value() []byte {
+	return m.cur.Value()
+}
+
+// Expire
+func (m *mergingIterator) Expire() int64 {
+	return m.cur.Expire()
+}
+
+// Error
+func (m *mergingIterator) Error() error {
+	for _, it := range m.iters {
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close
+func (m *mergingIterator) Close() error {
+	var errs []error
+	for _, it := range m.iters {
+		errs = append(errs, it.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// findSmallest
+func (m *mergingIterator) findSmallest() {
+	m.cur = nil
+	for _, it := range m.iters {
+		if it.Valid() && (m.cur == nil || bytes.Compare(it.Key(), m.cur.Key()) < 0) {
+			m.cur = it
+		}
+	}
+	m.skipDuplicates(Iterator.Next)
+}
+
+// findLargest
+func (m *mergingIterator) findLargest() {
+	m.cur = nil
+	for _, it := range m.iters {
+		if it.Valid() && (m.cur == nil || bytes.Compare(it.Key(), m.cur.Key()) > 0) {
+			m.cur = it
+		}
+	}
+	m.skipDuplicates(Iterator.Prev)
+}
+
+// skipDuplicates moves the other iterators positioned at the key of current entry by move.
+func (m *mergingIterator) skipDuplicates(move func(Iterator)) {
+	if m.cur == nil {
+		return
+	}
+	key := m.cur.Key()
+	for _, it := range m.iters {
+		if it != m.cur && it.Valid() && bytes.Equal(it.Key(), key) {
+			move(it)
+		}
+	}
+}
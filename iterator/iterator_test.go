@@ -0,0 +1,110 @@
+package iterator
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/memdb"
+)
+
+func getKey(i int) ikey.Key {
+	return ikey.Make([]byte(fmt.Sprintf("%08d", i)), 1, ikey.KindVal)
+}
+
+func TestMergingIterator(t *testing.T) {
+	assert := assert.New(t)
+
+	const num = 1000
+
+	// spread keys into 3 memdbs.
+	dbs := []*memdb.DB{memdb.New(1 << 20), memdb.New(1 << 20), memdb.New(1 << 20)}
+	for i := 0; i < num; i++ {
+		dbs[i%len(dbs)].Put(getKey(i), nil)
+	}
+	iters := make([]Iterator, 0, len(dbs))
+	for _, db := range dbs {
+		iters = append(iters, db.NewIterator())
+	}
+	it := NewMergingIterator(iters...)
+
+	// forward.
+	i := 0
+	for it.First(); it.Valid(); it.Next() {
+		assert.Equal(getKey(i), it.Key())
+		i++
+	}
+	assert.Equal(num, i)
+
+	// backward.
+	for it.Last(); it.Valid(); it.Prev() {
+		i--
+		assert.Equal(getKey(i), it.Key())
+	}
+	assert.Equal(0, i)
+
+	// switch direction.
+	it.Seek(getKey(500))
+	assert.Equal(getKey(500), it.Key())
+	it.Prev()
+	assert.Equal(getKey(499), it.Key())
+	it.Next()
+	assert.Equal(getKey(500), it.Key())
+	it.Next()
+	assert.Equal(getKey(501), it.Key())
+	it.Prev()
+	it.Prev()
+	assert.Equal(getKey(499), it.Key())
+
+	it.Seek(getKey(num))
+	assert.False(it.Valid())
+
+	assert.Nil(it.Error())
+	assert.Nil(it.Close())
+
+	// empty.
+	it = NewMergingIterator()
+	it.First()
+	assert.False(it.Valid())
+}
+
+func TestMergingIteratorDuplicates(t *testing.T) {
+	assert := assert.New(t)
+
+	const num = 1000
+
+	// the same entries are in both memdbs.
+	dbs := []*memdb.DB{memdb.New(1 << 20), memdb.New(1 << 20)}
+	for i := 0; i < num; i++ {
+		dbs[0].Put(getKey(i), nil)
+		if i%2 == 0 {
+			dbs[1].Put(getKey(i), nil)
+		}
+	}
+	it := NewMergingIterator(dbs[0].NewIterator(), dbs[1].NewIterator())
+
+	i := 0
+	for it.First(); it.Valid(); it.Next() {
+		assert.Equal(getKey(i), it.Key())
+		i++
+	}
+	assert.Equal(num, i)
+	for it.Last(); it.Valid(); it.Prev() {
+		i--
+		assert.Equal(getKey(i), it.Key())
+	}
+	assert.Equal(0, i)
+
+	// switch direction.
+	it.Seek(getKey(500))
+	it.Next()
+	it.Prev()
+	assert.Equal(getKey(500), it.Key())
+	it.Prev()
+	assert.Equal(getKey(499), it.Key())
+	it.Next()
+	it.Next()
+	assert.Equal(getKey(501), it.Key())
+	assert.Nil(it.Close())
+}
@@ -0,0 +1,271 @@
+package lsm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIterator(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	// level1.
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+
+	// level0.
+	for i := 0; i < num; i += 2 {
+		lsm.Put(getKey(i), getValue(i, 1))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+
+	// memdbs.
+	for i := 0; i < num; i += 3 {
+		lsm.Delete(getKey(i))
+	}
+	for i := num; i < num+100; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	lsm.Delete(getKey(num + 99))
+
+	expected := func(i int) ([]byte, bool) {
+		if i%3 == 0 && i < num || i >= num+99 {
+			return nil, false
+		}
+		if i%2 == 0 && i < num {
+			return getValue(i, 1), true
+		}
+		return getValue(i, 0), true
+	}
+	check := func(it *Iterator) {
+		var i, count int
+		for it.First(); it.Valid(); it.Next() {
+			for ; ; i++ {
+				if _, ok := expected(i); ok {
+					break
+				}
+			}
+			value, _ := expected(i)
+			assert.Equal(getKey(i), it.Key())
+			assert.Equal(value, it.Value())
+			i++
+			count++
+		}
+		assert.Equal(num+99-(num+2)/3, count)
+
+		// seek.
+		it.Seek(getKey(3))
+		assert.True(it.Valid())
+		assert.Equal(getKey(4), it.Key())
+		it.Seek(getKey(num + 99))
+		assert.False(it.Valid())
+
+		// last.
+		it.Last()
+		assert.True(it.Valid())
+		assert.Equal(getKey(num+98), it.Key())
+		assert.Equal(getValue(num+98, 0), it.Value())
+		it.Next()
+		assert.False(it.Valid())
+	}
+
+	it := lsm.NewIterator(nil)
+	snap := lsm.NewSnapshot()
+	defer snap.Release()
+
+	// changes after the iterator is created are invisible.
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 2))
+	}
+	lsm.Delete(getKey(num + 98))
+	check(it)
+
+	// tables are retained until the iterator is closed.
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+	check(it)
+	assert.Nil(it.Close())
+
+	it = snap.NewIterator(nil)
+	check(it)
+	assert.Nil(it.Close())
+
+	// empty.
+	empty := newTestLSM(t, t.TempDir())
+	defer empty.Close()
+	it = empty.NewIterator(nil)
+	it.First()
+	assert.False(it.Valid())
+	it.Last()
+	assert.False(it.Valid())
+	assert.Nil(it.Close())
+}
+
+func TestIteratorReverse(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+
+	// overwrite and delete in level0 and memdb.
+	for i := 0; i < num; i += 2 {
+		lsm.Put(getKey(i), getValue(i, 1))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	for i := 0; i < num; i += 3 {
+		lsm.Delete(getKey(i))
+	}
+
+	visible := func(i int) bool {
+		return i%3 != 0
+	}
+	value := func(i int) []byte {
+		return getValue(i, 1-i%2)
+	}
+
+	it := lsm.NewIterator(nil)
+	defer it.Close()
+
+	i := num - 1
+	for it.Last(); it.Valid(); it.Prev() {
+		for !visible(i) {
+			i--
+		}
+		assert.Equal(getKey(i), it.Key())
+		assert.Equal(value(i), it.Value())
+		i--
+	}
+	assert.Equal(0, i)
+
+	// seek for prev.
+	it.SeekForPrev(getKey(3))
+	assert.Equal(getKey(2), it.Key())
+	it.SeekForPrev(getKey(4))
+	assert.Equal(getKey(4), it.Key())
+	it.SeekForPrev(getKey(0))
+	assert.False(it.Valid())
+	it.SeekForPrev(getKey(num * 2))
+	assert.Equal(getKey(num-2), it.Key())
+
+	// switch direction.
+	it.Seek(getKey(100))
+	assert.Equal(getKey(100), it.Key())
+	it.Prev()
+	assert.Equal(getKey(98), it.Key())
+	it.Prev()
+	assert.Equal(getKey(97), it.Key())
+	it.Next()
+	assert.Equal(getKey(98), it.Key())
+	assert.Equal(value(98), it.Value())
+	it.Next()
+	assert.Equal(getKey(100), it.Key())
+
+	it.First()
+	assert.Equal(getKey(1), it.Key())
+	it.Prev()
+	assert.False(it.Valid())
+}
+
+func TestIteratorBounds(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+	for i := 0; i < num; i += 2 {
+		lsm.Put(getKey(i), getValue(i, 1))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.Delete(getKey(5000))
+
+	const lower, upper = 4000, 6000
+
+	it := lsm.NewIterator(&IterOptions{LowerBound: getKey(lower), UpperBound: getKey(upper)})
+	defer it.Close()
+
+	visible := func(i int) bool {
+		return i >= lower && i < upper && i != 5000
+	}
+	value := func(i int) []byte {
+		return getValue(i, 1-i%2)
+	}
+
+	// forward.
+	var count int
+	for it.First(); it.Valid(); it.Next() {
+		i := lower + count
+		if !visible(i) {
+			i++
+			count++
+		}
+		assert.Equal(getKey(i), it.Key())
+		assert.Equal(value(i), it.Value())
+		count++
+	}
+	assert.Equal(upper-lower, count)
+
+	// backward.
+	count = 0
+	for it.Last(); it.Valid(); it.Prev() {
+		i := upper - 1 - count
+		if !visible(i) {
+			i--
+			count++
+		}
+		assert.Equal(getKey(i), it.Key())
+		assert.Equal(value(i), it.Value())
+		count++
+	}
+	assert.Equal(upper-lower, count)
+
+	// seek out of bounds.
+	it.Seek(getKey(0))
+	assert.Equal(getKey(lower), it.Key())
+	it.Seek(getKey(upper))
+	assert.False(it.Valid())
+	it.SeekForPrev(getKey(num))
+	assert.Equal(getKey(upper-1), it.Key())
+	it.SeekForPrev(getKey(lower - 1))
+	assert.False(it.Valid())
+
+	// switch direction at bounds.
+	it.First()
+	it.Next()
+	it.Prev()
+	assert.Equal(getKey(lower), it.Key())
+	it.Prev()
+	assert.False(it.Valid())
+	it.Last()
+	it.Prev()
+	it.Next()
+	assert.Equal(getKey(upper-1), it.Key())
+	it.Next()
+	assert.False(it.Valid())
+}
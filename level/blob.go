@@ -0,0 +1,214 @@
+package level
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/xgzlucario/LSM/blob"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/iterator"
+	"github.com/xgzlucario/LSM/table"
+)
+
+// blobFile is a blob file referenced by tables.
+type blobFile struct {
+	*blob.File
+
+	// refs is the number of tables referencing it which are not removed,
+	// the blob file is removed after all of them are removed.
+	refs int
+}
+
+// refBlobs opens the blob files referenced by table t, they are released after t is removed.
+func (c *Controller) refBlobs(t *table.Table) error {
+	refs := t.BlobRefs()
+	if len(refs) == 0 {
+		return nil
+	}
+
+	c.blobMu.Lock()
+	defer c.blobMu.Unlock()
+
+	var opened []uint64
+	for id := range refs {
+		if c.blobs[id] != nil {
+			continue
+		}
+		file, err := blob.Open(blob.Path(c.dir, id), id)
+		if err != nil {
+			for _, id := range opened {
+				c.blobs[id].Close()
+				delete(c.blobs, id)
+			}
+			return err
+		}
+		c.blobs[id] = &blobFile{File: file}
+		opened = append(opened, id)
+	}
+	for id := range refs {
+		c.blobs[id].refs++
+	}
+
+	t.OnRemove(func() {
+		c.blobMu.Lock()
+		defer c.blobMu.Unlock()
+		for id := range refs {
+			if f := c.blobs[id]; f != nil {
+				if f.refs--; f.refs == 0 {
+					f.Remove()
+					delete(c.blobs, id)
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// removeUnusedBlobs removes the blob files not referenced by any table,
+// which are left by a crash before the tables are written or after they are removed.
+func (c *Controller) removeUnusedBlobs() error {
+	paths, err := filepath.Glob(filepath.Join(c.dir, "*.blob"))
+	if err != nil {
+		return err
+	}
+
+	c.blobMu.RLock()
+	defer c.blobMu.RUnlock()
+	for _, path := range paths {
+		if id, ok := blob.ParsePath(path); ok && c.blobs[id] == nil {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readBlob return the value of blob pointer, the blob file is referenced by the table
+// of pointer, which must not be removed until it returns.
+func (c *Controller) readBlob(pointer []byte) ([]byte, error) {
+	p, err := blob.Decode(pointer)
+	if err != nil {
+		return nil, err
+	}
+	c.blobMu.RLock()
+	f := c.blobs[p.File]
+	c.blobMu.RUnlock()
+
+	if f == nil {
+		return nil, fmt.Errorf("level: blob file %d not found", p.File)
+	}
+	return f.Read(p)
+}
+
+// blobsToCollect return the blob files whose ratio of records referenced by tables
+// is below option.BlobGCRatio. c.mu must be held.
+func (c *Controller) blobsToCollect() map[uint64]bool {
+	live := make(map[uint64]uint64)
+	for _, handler := range c.handlers {
+		for _, t := range handler.tables {
+			for id, size := range t.BlobRefs() {
+				live[id] += size
+			}
+		}
+	}
+
+	c.blobMu.RLock()
+	defer c.blobMu.RUnlock()
+
+	gc := make(map[uint64]bool)
+	for id, f := range c.blobs {
+		if float64(live[id]) < c.opt.BlobGCRatio*float64(f.Size()) {
+			gc[id] = true
+		}
+	}
+	return gc
+}
+
+// blobIterator returns the entries of KindBlob as KindVal, whose values are read from blob files.
+type blobIterator struct {
+	iterator.Iterator
+	c *Controller
+
+	// key and value of the current KindBlob entry, nil if it is not.
+	key   ikey.Key
+	value []byte
+	err   error
+}
+
+// newBlobIterator
+func (c *Controller) newBlobIterator(it iterator.Iterator) *blobIterator {
+	return &blobIterator{Iterator: it, c: c}
+}
+
+// load reads the value of current entry if it is KindBlob.
+func (it *blobIterator) load() {
+	it.key, it.value = nil, nil
+	if !it.Iterator.Valid() {
+		return
+	}
+	k := it.Iterator.Key()
+	if k.Kind() != ikey.KindBlob {
+		return
+	}
+	value, err := it.c.readBlob(it.Iterator.Value())
+	if err != nil && it.err == nil {
+		it.err = err
+	}
+	it.key, it.value = ikey.Make(k.UserKey(), k.Seq(), ikey.KindVal), value
+}
+
+// First
+func (it *blobIterator) First() {
+	it.Iterator.First()
+	it.load()
+}
+
+// Last
+func (it *blobIterator) Last() {
+	it.Iterator.Last()
+	it.load()
+}
+
+// Seek
+func (it *blobIterator) Seek(key ikey.Key) {
+	it.Iterator.Seek(key)
+	it.load()
+}
+
+// Next
+func (it *blobIterator) Next() {
+	it.Iterator.Next()
+	it.load()
+}
+
+// Prev
+func (it *blobIterator) Prev() {
+	it.Iterator.Prev()
+	it.load()
+}
+
+// Key
+func (it *blobIterator) Key() ikey.Key {
+	if it.key != nil {
+		return it.key
+	}
+	return it.Iterator.Key()
+}
+
+// Value
+func (it *blobIterator) Value() []byte {
+	if it.key != nil {
+		return it.value
+	}
+	return it.Iterator.Value()
+}
+
+// Error
+func (it *blobIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Error()
+}
@@ -1,14 +1,26 @@
 package level
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/fs"
+	"math"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/xgzlucario/LSM/bcmp"
+	"github.com/xgzlucario/LSM/blob"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/iterator"
 	"github.com/xgzlucario/LSM/memdb"
 	"github.com/xgzlucario/LSM/option"
+	"github.com/xgzlucario/LSM/rangedel"
 	"github.com/xgzlucario/LSM/table"
 )
 
@@ -20,11 +32,20 @@ const (
 // Controller is a levels controller in lsm-tree.
 type Controller struct {
 	mu          sync.RWMutex
+	compactMu   sync.Mutex // serializes compactions, so that level1+ is only changed by the holder.
 	tid         atomic.Uint64
 	dir         string
 	opt         *option.Option
 	handlers    [maxLevel]*handler
 	tableWriter *table.Writer
+
+	// level0Tables is the number of level0 tables, which is read without mu.
+	level0Tables atomic.Int64
+
+	// blobs is the blob files referenced by tables, which is guarded by blobMu instead of mu,
+	// because tables are removed with mu held or not.
+	blobMu sync.RWMutex
+	blobs  map[uint64]*blobFile
 }
 
 // NewController
@@ -32,7 +53,8 @@ func NewController(dir string, opt *option.Option) *Controller {
 	c := &Controller{
 		dir:         dir,
 		opt:         opt,
-		tableWriter: table.NewWriter(opt),
+		tableWriter: table.NewWriter(dir, opt),
+		blobs:       make(map[uint64]*blobFile),
 	}
 	for i := range c.handlers {
 		c.handlers[i] = &handler{
@@ -55,29 +77,52 @@ func (c *Controller) BuildFromDisk() error {
 	// walk dir.
 	err := filepath.WalkDir(c.dir, func(path string, entry fs.DirEntry, err error) error {
 		if err != nil {
-			panic(err)
+			return err
 		}
+		// sub directories belong to the other column families.
 		if entry.IsDir() {
+			if path != c.dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// remove the partial table left by a crash.
+		if strings.HasSuffix(path, table.TmpExt) {
+			return os.Remove(path)
+		}
+		// create reader, skip files which are not sstables.
+		t, err := table.NewReader(path, c.opt)
+		if errors.Is(err, table.ErrTableName) {
 			return nil
 		}
-		// create reader.
-		table, err := table.NewReader(path, c.opt)
 		if err != nil {
 			return err
 		}
-		c.handlers[table.Level()].addTables(table)
+		if err := c.refBlobs(t); err != nil {
+			t.Close()
+			return err
+		}
+		c.handlers[t.Level()].addTables(t)
 
+		// restore table id.
+		if t.ID() > c.tid.Load() {
+			c.tid.Store(t.ID())
+		}
 		return nil
 	})
 	if err != nil {
 		return err
 	}
+	if err := c.removeUnusedBlobs(); err != nil {
+		return err
+	}
 
 	fmt.Println("controller: build from disk.")
 
 	for _, handler := range c.handlers {
 		handler.sortTables()
 	}
+	c.level0Tables.Store(int64(len(c.handlers[0].tables)))
 	c.Print()
 
 	return nil
@@ -90,60 +135,547 @@ func (c *Controller) Print() {
 	}
 }
 
-// Compact
-func (c *Controller) Compact() error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+// Compact merges level0 tables with the overlapping level1 tables into level1.
+// entries deleted by range tombstones are dropped, and the tables entirely deleted are not read.
+// expired entries are turned into tombstones, which are dropped at the bottom level.
+// versions visible to the snapshot of smallestSeq and the newer ones are retained.
+// the values in blob files to be collected are rewritten into new blob files.
+// with FIFOCompaction, the oldest tables beyond FIFOMaxTableSize are dropped instead.
+func (c *Controller) Compact(smallestSeq uint64) error {
+	c.compactMu.Lock()
+	defer c.compactMu.Unlock()
+
+	if c.opt.CompactionStyle == option.FIFOCompaction {
+		c.compactFIFO()
+		return nil
+	}
+	c.mu.RLock()
+	tables := slices.Clone(c.handlers[0].tables)
+	c.mu.RUnlock()
+	return c.compact(tables, nil, smallestSeq)
+}
 
-	var tables, truncateTables []*table.Table
-	var toLevel int
+// CompactRange is Compact of the tables overlapping user keys [start, end), nil means unbounded.
+// level0 tables overlapping the picked ones are compacted together, so that no older version
+// of their keys is left in level0, and level1 tables in the range are rewritten.
+// it is Compact with FIFOCompaction, since tables are never merged.
+func (c *Controller) CompactRange(start, end []byte, smallestSeq uint64) error {
+	c.compactMu.Lock()
+	defer c.compactMu.Unlock()
 
-	// compact each level.
-	for _, handler := range c.handlers {
-		if handler.level == 0 {
-			truncateTables = handler.tables
-			tables = nil
-			toLevel = 1
+	if c.opt.CompactionStyle == option.FIFOCompaction {
+		c.compactFIFO()
+		return nil
+	}
+
+	// the table without bounds has no entries, which is always compacted.
+	inRange := func(t *table.Table) bool {
+		return t.GetMinKey() == nil || (start == nil || bytes.Compare(ikey.Key(t.GetMaxKey()).UserKey(), start) >= 0) &&
+			(end == nil || bytes.Compare(ikey.Key(t.GetMinKey()).UserKey(), end) < 0)
+	}
+
+	c.mu.RLock()
+	level0Tables := slices.Clone(c.handlers[0].tables)
+	c.mu.RUnlock()
 
-		} else {
-			tables, truncateTables = handler.findOverlapTables()
-			toLevel = handler.level
+	var minKey, maxKey ikey.Key
+	picked := make([]bool, len(level0Tables))
+	for changed := true; changed; {
+		changed = false
+		for i, t := range level0Tables {
+			overlap := minKey != nil && t.GetMinKey() != nil && ikey.Key(t.GetMaxKey()).CompareUserKey(minKey) >= 0 &&
+				ikey.Key(t.GetMinKey()).CompareUserKey(maxKey) <= 0
+			if picked[i] || !inRange(t) && !overlap {
+				continue
+			}
+			picked[i], changed = true, true
+			if t.GetMinKey() == nil {
+				continue
+			}
+			if minKey == nil {
+				minKey, maxKey = t.GetMinKey(), t.GetMaxKey()
+			}
+			minKey = bcmp.Min(minKey, t.GetMinKey())
+			maxKey = bcmp.Max(maxKey, t.GetMaxKey())
 		}
+	}
 
-		if len(truncateTables) == 0 {
-			continue
+	var tables []*table.Table
+	for i, t := range level0Tables {
+		if picked[i] {
+			tables = append(tables, t)
 		}
+	}
+	return c.compact(tables, inRange, smallestSeq)
+}
 
-		db := table.MergeTables(truncateTables...)
+// compact merges the level0 tables with the overlapping level1 tables into level1,
+// level1 tables matched by rewrite are compacted too. c.compactMu must be held,
+// and c.mu is only held to pick the tables and to install the output tables,
+// so that readers are not blocked by merging.
+func (c *Controller) compact(level0Tables []*table.Table, rewrite func(*table.Table) bool, smallestSeq uint64) error {
+	level0, level1 := c.handlers[0], c.handlers[1]
 
-		// split merged memdb.
-		err := db.SplitFunc(c.opt.MemDBSize, func(db *memdb.DB) error {
-			table, err := c.tableWriter.WriteTable(toLevel, c.tid.Add(1), db)
-			if err != nil {
-				return err
-			}
-			c.handlers[toLevel].addTables(table)
-			return nil
+	// level1+ is not changed by others, since compactions are serialized.
+	c.mu.RLock()
+	level1Tables := level1.tables
+
+	// tombstones are useless when there is no older data beneath them.
+	dropDeleted := c.isBottomLevel(1)
+
+	// the table without bounds has no entries, e.g. with only empty range tombstones.
+	var minKey, maxKey ikey.Key
+	addRange := func(t *table.Table) {
+		if t.GetMinKey() == nil {
+			return
+		}
+		if minKey == nil {
+			minKey, maxKey = t.GetMinKey(), t.GetMaxKey()
+			return
+		}
+		minKey = bcmp.Min(minKey, t.GetMinKey())
+		maxKey = bcmp.Max(maxKey, t.GetMaxKey())
+	}
+	for _, t := range level0Tables {
+		addRange(t)
+	}
+	// level1 tables with range tombstones visible to all snapshots are compacted again,
+	// so that the covered entries are dropped eventually.
+	// so are the tables referencing blob files to be collected.
+	gc := c.blobsToCollect()
+	c.mu.RUnlock()
+	for _, t := range level1Tables {
+		visibleRangeDel := dropDeleted && slices.ContainsFunc(t.RangeDels(), func(tomb rangedel.Tombstone) bool {
+			return tomb.Seq <= smallestSeq
 		})
-		if err != nil {
-			panic(err)
+		var collected bool
+		for id := range t.BlobRefs() {
+			collected = collected || gc[id]
+		}
+		if visibleRangeDel || collected || rewrite != nil && rewrite(t) {
+			addRange(t)
 		}
+	}
+	if minKey == nil && len(level0Tables) == 0 {
+		return nil
+	}
+	tables, overlapTables := slices.Clone(level1Tables), []*table.Table(nil)
+	if minKey != nil {
+		tables, overlapTables = findOverlapTables(level1Tables, minKey, maxKey)
+	}
 
-		// delete truncate tables.
-		handler.delTables(truncateTables...)
-		handler.tables = tables
-		handler.sortTables()
+	truncateTables := append(overlapTables, level0Tables...)
+
+	// range tombstones visible to all snapshots delete the covered entries.
+	var rangeDels rangedel.List
+	for _, t := range truncateTables {
+		rangeDels = append(rangeDels, t.RangeDels()...)
 	}
+	frags := rangeDels.Fragment()
+
+	iters := make([]iterator.Iterator, 0, len(truncateTables))
+	for _, t := range truncateTables {
+		// skip the table whose entries are all deleted.
+		if !isCovered(t, rangeDels, smallestSeq) {
+			iters = append(iters, t.NewIterator(nil, nil))
+		}
+	}
+	it := iterator.NewMergingIterator(iters...)
+
+	// split merged entries.
+	sp := c.newSplitter(1)
+	for _, t := range rangeDels {
+		if !dropDeleted || t.Seq > smallestSeq {
+			sp.rangeDels = append(sp.rangeDels, t)
+		}
+	}
+	var err error
+	var lastKey ikey.Key
+	now := time.Now().UnixNano()
+
+	for it.First(); it.Valid() && err == nil; {
+		key, value, expire := it.Key(), it.Value(), it.Expire()
+		if expire != 0 && expire <= now {
+			key, value, expire = ikey.Make(key.UserKey(), key.Seq(), ikey.KindDel), nil, 0
+		}
+
+		// the newer version of user key is visible to all snapshots,
+		// unless it is a merge operand, which needs the older versions.
+		// lastKey is the newest version not shadowed, so that the shadowed merge operands
+		// do not bring back the older versions.
+		shadowed := lastKey != nil && key.SameUserKey(lastKey) && lastKey.Seq() <= smallestSeq &&
+			lastKey.Kind() != ikey.KindMerge
+		if !shadowed {
+			lastKey = append(lastKey[:0], key...)
+		}
+
+		switch {
+		case shadowed:
+		case dropDeleted && key.Kind() == ikey.KindDel && key.Seq() <= smallestSeq:
+		case len(frags) > 0 && key.Seq() < frags.MaxSeq(key.UserKey(), smallestSeq):
+
+		// collapse the merge operands visible to all snapshots into a value,
+		// and then the older versions are shadowed.
+		case dropDeleted && key.Kind() == ikey.KindMerge && key.Seq() <= smallestSeq && c.opt.MergeOperator != nil:
+			var value []byte
+			var operands []entry
+			if value, operands, err = c.mergeOperands(it, frags, smallestSeq, now); err != nil {
+				continue
+			}
+			// the value too large for memdb is not collapsed, the operands and older versions are kept.
+			if len(value) > math.MaxUint16 || memdb.EntrySize(lastKey, value) > c.opt.MemDBSize {
+				for _, op := range operands {
+					if err = sp.add(op.key, op.value, op.expire); err != nil {
+						break
+					}
+				}
+				continue
+			}
+			lastKey = ikey.Make(lastKey.UserKey(), lastKey.Seq(), ikey.KindVal)
+			err = sp.add(lastKey, value, 0)
+			continue
+
+		// the value is separated into a new blob file again.
+		case key.Kind() == ikey.KindBlob && gc[blobFileOf(value)]:
+			if value, err = c.readBlob(value); err == nil {
+				err = sp.add(ikey.Make(key.UserKey(), key.Seq(), ikey.KindVal), value, expire)
+			}
+
+		default:
+			err = sp.add(key, value, expire)
+		}
+		it.Next()
+	}
+	if err == nil {
+		err = it.Error()
+	}
+	if err == nil {
+		err = sp.flush()
+	}
+	err = errors.Join(err, it.Close())
+	if err != nil {
+		// levels are not changed, remove the tables written.
+		for _, t := range sp.tables {
+			t.Remove()
+		}
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// level0.tables may be shared with readers, so the remaining tables are copied,
+	// including the tables added during compaction.
+	var remaining []*table.Table
+	for _, t := range level0.tables {
+		if !slices.Contains(level0Tables, t) {
+			remaining = append(remaining, t)
+		}
+	}
+	level0.tables = remaining
+	c.level0Tables.Store(int64(len(level0.tables)))
+	level1.tables = tables
+	level1.addTables(sp.tables...)
+
+	// delete truncate tables.
+	level0.delTables(truncateTables...)
+	level1.sortTables()
 
 	return nil
 }
 
+// compactFIFO drops the oldest level0 tables until their total size is within FIFOMaxTableSize,
+// the tables are removed once the iterators referencing them are closed.
+// level1 tables written by LevelCompaction before are kept.
+func (c *Controller) compactFIFO() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	level0 := c.handlers[0]
+	size := c.level0Size()
+	n := 0
+	for n < len(level0.tables) && c.opt.FIFOMaxTableSize > 0 && size > c.opt.FIFOMaxTableSize {
+		s, _ := level0.tables[n].Approximate(nil, nil)
+		size -= s
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	// level0.tables may be shared with readers, so the remaining tables are copied.
+	dropped := level0.tables[:n]
+	level0.tables = slices.Clone(level0.tables[n:])
+	c.level0Tables.Store(int64(len(level0.tables)))
+	level0.delTables(dropped...)
+}
+
+// level0Size return the total size of level0 tables, c.mu must be held.
+func (c *Controller) level0Size() (size uint64) {
+	for _, t := range c.handlers[0].tables {
+		s, _ := t.Approximate(nil, nil)
+		size += s
+	}
+	return size
+}
+
+// CompactionPending return true if Compact has work to do, which is any level0 table
+// with LevelCompaction, or level0 exceeding FIFOMaxTableSize with FIFOCompaction.
+func (c *Controller) CompactionPending() bool {
+	if c.opt.CompactionStyle != option.FIFOCompaction {
+		return c.NumLevel0Tables() > 0
+	}
+	if c.opt.FIFOMaxTableSize == 0 {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.level0Size() > c.opt.FIFOMaxTableSize
+}
+
 // AddLevel0Table
 func (c *Controller) AddLevel0Table(db *memdb.DB) error {
+	if db.Empty() {
+		return nil
+	}
 	table, err := c.tableWriter.WriteTable(0, c.tid.Add(1), db)
 	if err != nil {
 		return err
 	}
+	if err := c.refBlobs(table); err != nil {
+		table.Remove()
+		os.Remove(blob.Path(c.dir, table.ID()))
+		return err
+	}
+	c.mu.Lock()
 	c.handlers[0].addTables(table)
+	c.level0Tables.Store(int64(len(c.handlers[0].tables)))
+	c.mu.Unlock()
+	return nil
+}
+
+// Checkpoint hard links the tables and the blob files referenced by them into dir.
+func (c *Controller) Checkpoint(dir string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, handler := range c.handlers {
+		for _, t := range handler.tables {
+			if err := os.Link(t.Path(), filepath.Join(dir, filepath.Base(t.Path()))); err != nil {
+				return err
+			}
+		}
+	}
+
+	c.blobMu.RLock()
+	defer c.blobMu.RUnlock()
+	for id := range c.blobs {
+		if err := os.Link(blob.Path(c.dir, id), blob.Path(dir, id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes all tables without removing them.
+func (c *Controller) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var err error
+	for _, handler := range c.handlers {
+		for _, t := range handler.tables {
+			err = errors.Join(err, t.Close())
+		}
+		handler.tables = nil
+	}
+	c.level0Tables.Store(0)
+
+	c.blobMu.Lock()
+	defer c.blobMu.Unlock()
+	for id, f := range c.blobs {
+		err = errors.Join(err, f.Close())
+		delete(c.blobs, id)
+	}
+	return err
+}
+
+// Drop releases all tables, which are removed with their blob files once the iterators
+// referencing them are closed. the reads holding mu are done before.
+func (c *Controller) Drop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, handler := range c.handlers {
+		handler.delTables(handler.tables...)
+		handler.tables = nil
+	}
+	c.level0Tables.Store(0)
+}
+
+// NumLevel0Tables return the number of level0 tables.
+func (c *Controller) NumLevel0Tables() int {
+	return int(c.level0Tables.Load())
+}
+
+// Get find the newest value and kind of key whose sequence number is not greater than seq,
+// from level0 to the last level. the search stops at the first tombstone.
+func (c *Controller) Get(key []byte, seq uint64) ([]byte, ikey.Kind, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, handler := range c.handlers {
+		value, kind, err := handler.get(key, seq)
+		if errors.Is(err, table.ErrKeyNotFound) {
+			continue
+		}
+		if err == nil && kind == ikey.KindBlob {
+			value, err = c.readBlob(value)
+			kind = ikey.KindVal
+		}
+		return value, kind, err
+	}
+	return nil, 0, table.ErrKeyNotFound
+}
+
+// Lookup is a user key to find by MultiGet, Found is set with Value and Kind by the first level having it.
+type Lookup struct {
+	Key   []byte
+	Value []byte
+	Kind  ikey.Kind
+	Found bool
+}
+
+// MultiGet is Get of the lookups, which must be sorted by key. each level is searched by
+// the lookups not found yet together, and the tables of level1+ are searched concurrently
+// if parallel is set.
+func (c *Controller) MultiGet(lookups []*Lookup, seq uint64, parallel bool) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	pending := lookups
+	for _, handler := range c.handlers {
+		pending = notFound(pending)
+		if len(pending) == 0 {
+			break
+		}
+		if err := handler.multiGet(pending, seq, parallel); err != nil {
+			return err
+		}
+	}
+
+	for _, l := range lookups {
+		if l.Found && l.Kind == ikey.KindBlob {
+			value, err := c.readBlob(l.Value)
+			if err != nil {
+				return err
+			}
+			l.Value, l.Kind = value, ikey.KindVal
+		}
+	}
 	return nil
 }
+
+// Approximate return the size and number of entries of tables in user keys [start, end),
+// nil means unbounded, which is estimated without reading data blocks.
+func (c *Controller) Approximate(start, end []byte) (size, count uint64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, handler := range c.handlers {
+		for _, t := range handler.tables {
+			s, n := t.Approximate(start, end)
+			size += s
+			count += n
+		}
+	}
+	return size, count
+}
+
+// MaxSeq return the max sequence number of all tables.
+func (c *Controller) MaxSeq() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var seq uint64
+	for _, handler := range c.handlers {
+		for _, t := range handler.tables {
+			seq = max(seq, t.MaxSeq())
+		}
+	}
+	return seq
+}
+
+// entry is an entry of iterator.
+type entry struct {
+	key    ikey.Key
+	value  []byte
+	expire int64
+}
+
+// mergeOperands merges the operand of it and the older versions of the same user key,
+// it is moved to the first entry which is not merged. the expired value or the value deleted by
+// a range tombstone visible to smallestSeq is regarded as deleted.
+// the merged operands are returned too, from newer to older.
+func (c *Controller) mergeOperands(it iterator.Iterator, frags rangedel.Fragments, smallestSeq uint64, now int64) ([]byte, []entry, error) {
+	key := slices.Clone(it.Key())
+	operands := [][]byte{slices.Clone(it.Value())}
+	entries := []entry{{key: key, value: operands[0], expire: it.Expire()}}
+
+	var existing []byte
+	for it.Next(); it.Valid() && it.Key().SameUserKey(key); it.Next() {
+		k := it.Key()
+		if len(frags) > 0 && k.Seq() < frags.MaxSeq(k.UserKey(), smallestSeq) || k.Kind() == ikey.KindDel {
+			break
+		}
+		if expire := it.Expire(); expire != 0 && expire <= now {
+			break
+		}
+		if k.Kind() == ikey.KindVal {
+			existing = append([]byte{}, it.Value()...)
+			break
+		}
+		if k.Kind() == ikey.KindBlob {
+			value, err := c.readBlob(it.Value())
+			if err != nil {
+				return nil, nil, err
+			}
+			existing = value
+			break
+		}
+		operands = append(operands, slices.Clone(it.Value()))
+		entries = append(entries, entry{key: slices.Clone(k), value: operands[len(operands)-1], expire: it.Expire()})
+	}
+
+	// operands are collected from newer to older.
+	slices.Reverse(operands)
+	return c.opt.MergeOperator.Merge(key.UserKey(), existing, operands), entries, nil
+}
+
+// blobFileOf return the blob file id of pointer, 0 if it is invalid.
+func blobFileOf(pointer []byte) uint64 {
+	p, _ := blob.Decode(pointer)
+	return p.File
+}
+
+// isCovered return true if all entries of table are deleted by a range tombstone visible to all snapshots.
+func isCovered(t *table.Table, rangeDels rangedel.List, smallestSeq uint64) bool {
+	if t.GetMinKey() == nil {
+		return true
+	}
+	minKey, maxKey := ikey.Key(t.GetMinKey()).UserKey(), ikey.Key(t.GetMaxKey()).UserKey()
+	for _, tomb := range rangeDels {
+		if tomb.Seq <= smallestSeq && t.MaxSeq() < tomb.Seq && tomb.Contains(minKey) && tomb.Contains(maxKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBottomLevel return true if there is no data beneath the level.
+func (c *Controller) isBottomLevel(level int) bool {
+	for _, handler := range c.handlers[level+1:] {
+		if len(handler.tables) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,560 @@
+package level
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/blob"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/iterator"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/option"
+	"github.com/xgzlucario/LSM/rangedel"
+	"github.com/xgzlucario/LSM/table"
+)
+
+func getKey(i int) []byte {
+	return []byte(fmt.Sprintf("%08d", i))
+}
+
+// countEntries return the number of entries in level.
+func countEntries(c *Controller, level int) int {
+	it := newLevelIterator(c.handlers[level].tables, nil, nil)
+	defer it.Close()
+
+	var count int
+	for it.First(); it.Valid(); it.Next() {
+		count++
+	}
+	return count
+}
+
+func TestCompactTombstone(t *testing.T) {
+	assert := assert.New(t)
+	c := NewController(t.TempDir(), option.DefaultOption)
+
+	const num = 10000
+
+	db := memdb.New(option.DefaultOption.MemDBSize)
+	for i := 0; i < num; i++ {
+		db.Put(ikey.Make(getKey(i), 1, ikey.KindVal), getKey(i))
+	}
+	assert.Nil(c.AddLevel0Table(db))
+
+	// delete even keys.
+	db = memdb.New(option.DefaultOption.MemDBSize)
+	for i := 0; i < num; i += 2 {
+		db.Put(ikey.Make(getKey(i), 2, ikey.KindDel), nil)
+	}
+	assert.Nil(c.AddLevel0Table(db))
+
+	check := func() {
+		for i := 0; i < num; i++ {
+			value, kind, err := c.Get(getKey(i), ikey.MaxSeq)
+			if i%2 == 0 {
+				assert.Equal(ikey.KindDel, kind)
+			} else {
+				assert.Equal(getKey(i), value)
+				assert.Equal(ikey.KindVal, kind)
+			}
+			assert.Nil(err)
+		}
+	}
+	check()
+
+	// tombstones are kept if there is data beneath level1.
+	c.handlers[2].tables = []*table.Table{c.handlers[0].tables[0]}
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	check()
+	c.handlers[2].tables = nil
+
+	// tombstones are dropped in bottom level.
+	db = memdb.New(option.DefaultOption.MemDBSize)
+	db.Put(ikey.Make(getKey(1), 3, ikey.KindVal), getKey(1))
+	db.Put(ikey.Make(getKey(num), 3, ikey.KindVal), getKey(num))
+	assert.Nil(c.AddLevel0Table(db))
+	assert.Nil(c.Compact(ikey.MaxSeq))
+
+	for i := 0; i <= num; i++ {
+		value, kind, err := c.Get(getKey(i), ikey.MaxSeq)
+		if i%2 == 0 && i < num {
+			assert.ErrorIs(err, table.ErrKeyNotFound)
+		} else {
+			assert.Equal(getKey(i), value)
+			assert.Equal(ikey.KindVal, kind)
+			assert.Nil(err)
+		}
+	}
+	assert.Equal(uint64(3), c.MaxSeq())
+
+	// only the newest version is kept.
+	assert.Equal(num/2+1, countEntries(c, 1))
+}
+
+func TestCompactSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	c := NewController(t.TempDir(), option.DefaultOption)
+
+	const num = 1000
+
+	// versions: v1@1, v2@2, del@3.
+	for seq := uint64(1); seq <= 3; seq++ {
+		db := memdb.New(option.DefaultOption.MemDBSize)
+		for i := 0; i < num; i++ {
+			if seq == 3 {
+				db.Put(ikey.Make(getKey(i), seq, ikey.KindDel), nil)
+			} else {
+				db.Put(ikey.Make(getKey(i), seq, ikey.KindVal), []byte(fmt.Sprintf("v%d", seq)))
+			}
+		}
+		assert.Nil(c.AddLevel0Table(db))
+	}
+
+	check := func(seq uint64, value string, kind ikey.Kind) {
+		for i := 0; i < num; i++ {
+			v, k, err := c.Get(getKey(i), seq)
+			if value == "" && kind == 0 {
+				assert.ErrorIs(err, table.ErrKeyNotFound)
+				continue
+			}
+			assert.Nil(err)
+			assert.Equal(kind, k)
+			assert.Equal(value, string(v))
+		}
+	}
+	count := func() int {
+		return countEntries(c, 1)
+	}
+
+	// all versions are retained.
+	assert.Nil(c.Compact(1))
+	assert.Equal(num*3, count())
+	check(1, "v1", ikey.KindVal)
+	check(2, "v2", ikey.KindVal)
+	check(3, "", ikey.KindDel)
+
+	// v1 is shadowed by v2.
+	db := memdb.New(option.DefaultOption.MemDBSize)
+	db.Put(ikey.Make(getKey(0), 4, ikey.KindVal), []byte("v4"))
+	db.Put(ikey.Make(getKey(num), 4, ikey.KindVal), []byte("v4"))
+	assert.Nil(c.AddLevel0Table(db))
+
+	assert.Nil(c.Compact(2))
+	assert.Equal(num*2+2, count())
+	check(2, "v2", ikey.KindVal)
+
+	// tombstones visible to all snapshots are dropped.
+	db = memdb.New(option.DefaultOption.MemDBSize)
+	db.Put(ikey.Make(getKey(0), 5, ikey.KindVal), []byte("v5"))
+	db.Put(ikey.Make(getKey(num), 5, ikey.KindVal), []byte("v5"))
+	assert.Nil(c.AddLevel0Table(db))
+
+	assert.Nil(c.Compact(5))
+	assert.Equal(2, count())
+	check(3, "", 0)
+
+	value, kind, err := c.Get(getKey(0), 5)
+	assert.Nil(err)
+	assert.Equal(ikey.KindVal, kind)
+	assert.Equal("v5", string(value))
+}
+
+func TestCompactRangeDel(t *testing.T) {
+	assert := assert.New(t)
+	opt := *option.DefaultOption
+	opt.MemDBSize = 64 * option.KB
+	opt.DataBlockSize = 1 * option.KB
+	c := NewController(t.TempDir(), &opt)
+
+	const num = 10000
+	const start, end = 2000, 6000
+
+	db := memdb.New(16 * option.MB)
+	for i := 0; i < num; i++ {
+		db.Put(ikey.Make(getKey(i), 1, ikey.KindVal), getKey(i))
+	}
+	assert.Nil(c.AddLevel0Table(db))
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	numTables := len(c.handlers[1].tables)
+
+	// a level0 table with range tombstone only.
+	db = memdb.New(opt.MemDBSize)
+	db.PutRangeDel(rangedel.Tombstone{Start: getKey(start), End: getKey(end), Seq: 2})
+	assert.Nil(c.AddLevel0Table(db))
+
+	check := func() {
+		for i := 0; i < num; i++ {
+			value, kind, err := c.Get(getKey(i), ikey.MaxSeq)
+			if i >= start && i < end {
+				assert.Equal(ikey.KindDel, kind)
+			} else {
+				assert.Equal(getKey(i), value)
+				assert.Equal(ikey.KindVal, kind)
+			}
+			assert.Nil(err)
+		}
+		// invisible to the older snapshot.
+		value, kind, err := c.Get(getKey(start), 1)
+		assert.Equal(getKey(start), value)
+		assert.Equal(ikey.KindVal, kind)
+		assert.Nil(err)
+	}
+	check()
+
+	// retained for snapshot.
+	assert.Nil(c.Compact(1))
+	assert.Equal(num, countEntries(c, 1))
+	check()
+
+	// covered entries and tables are dropped.
+	db = memdb.New(opt.MemDBSize)
+	db.Put(ikey.Make(getKey(num), 3, ikey.KindVal), getKey(num))
+	assert.Nil(c.AddLevel0Table(db))
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	assert.Equal(num-(end-start)+1, countEntries(c, 1))
+	assert.Less(len(c.handlers[1].tables), numTables)
+
+	for i := 0; i <= num; i++ {
+		value, _, err := c.Get(getKey(i), ikey.MaxSeq)
+		if i >= start && i < end {
+			assert.ErrorIs(err, table.ErrKeyNotFound)
+		} else {
+			assert.Equal(getKey(i), value)
+			assert.Nil(err)
+		}
+	}
+	for _, t := range c.handlers[1].tables {
+		assert.Empty(t.RangeDels())
+	}
+}
+
+func TestCompactExpire(t *testing.T) {
+	assert := assert.New(t)
+	c := NewController(t.TempDir(), option.DefaultOption)
+
+	const num = 10000
+	past, future := time.Now().Add(-time.Second).UnixNano(), time.Now().Add(time.Hour).UnixNano()
+
+	db := memdb.New(option.DefaultOption.MemDBSize)
+	for i := 0; i < num; i++ {
+		db.Put(ikey.Make(getKey(i), 1, ikey.KindVal), getKey(i))
+	}
+	assert.Nil(c.AddLevel0Table(db))
+
+	// odd keys are overwritten by expired values, and the others never expire.
+	db = memdb.New(option.DefaultOption.MemDBSize)
+	for i := 0; i < num; i++ {
+		expire := future
+		if i%2 == 1 {
+			expire = past
+		}
+		db.PutWithExpire(ikey.Make(getKey(i), 2, ikey.KindVal), getKey(i), expire)
+	}
+	assert.Nil(c.AddLevel0Table(db))
+
+	check := func() {
+		for i := 0; i < num; i++ {
+			value, kind, err := c.Get(getKey(i), ikey.MaxSeq)
+			if i%2 == 1 {
+				assert.Equal(ikey.KindDel, kind)
+			} else {
+				assert.Equal(getKey(i), value)
+				assert.Equal(ikey.KindVal, kind)
+			}
+			assert.Nil(err)
+		}
+	}
+	check()
+
+	// expired entries are turned into tombstones, which hide the older versions for snapshot.
+	assert.Nil(c.Compact(1))
+	assert.Equal(num*2, countEntries(c, 1))
+	check()
+
+	// expired entries are dropped, and the expiry of others is kept.
+	db = memdb.New(option.DefaultOption.MemDBSize)
+	db.Put(ikey.Make(getKey(-1), 3, ikey.KindVal), getKey(-1))
+	db.Put(ikey.Make(getKey(num), 3, ikey.KindVal), getKey(num))
+	assert.Nil(c.AddLevel0Table(db))
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	assert.Equal(num/2+2, countEntries(c, 1))
+
+	for i := 0; i < num; i++ {
+		_, _, err := c.Get(getKey(i), ikey.MaxSeq)
+		if i%2 == 1 {
+			assert.ErrorIs(err, table.ErrKeyNotFound)
+		} else {
+			assert.Nil(err)
+		}
+	}
+	it := newLevelIterator(c.handlers[1].tables, nil, nil)
+	defer it.Close()
+	for it.First(); it.Valid(); it.Next() {
+		if it.Key().Seq() == 2 {
+			assert.Equal(future, it.Expire())
+		} else {
+			assert.Equal(int64(0), it.Expire())
+		}
+	}
+}
+
+func TestCompactRange(t *testing.T) {
+	assert := assert.New(t)
+	c := NewController(t.TempDir(), option.DefaultOption)
+
+	addTable := func(start, end int, seq uint64, kind ikey.Kind) {
+		db := memdb.New(option.DefaultOption.MemDBSize)
+		for i := start; i < end; i++ {
+			db.Put(ikey.Make(getKey(i), seq, kind), getKey(i))
+		}
+		assert.Nil(c.AddLevel0Table(db))
+	}
+	check := func(deleted int) {
+		for i := 0; i < 300; i++ {
+			value, _, err := c.Get(getKey(i), ikey.MaxSeq)
+			if i < deleted || i >= 150 && i < 200 {
+				assert.ErrorIs(err, table.ErrKeyNotFound)
+			} else {
+				assert.Equal(getKey(i), value)
+			}
+		}
+	}
+
+	addTable(0, 100, 1, ikey.KindVal)
+	addTable(200, 300, 2, ikey.KindVal)
+	addTable(90, 150, 3, ikey.KindVal)
+
+	// the older level0 table overlapping the picked one is compacted together.
+	assert.Nil(c.CompactRange(getKey(120), getKey(130), ikey.MaxSeq))
+	assert.Equal(1, c.NumLevel0Tables())
+	assert.Equal(uint64(2), c.handlers[0].tables[0].MaxSeq())
+	assert.Equal(150, countEntries(c, 1))
+	check(0)
+
+	// tombstones are dropped at the bottom level.
+	addTable(0, 50, 4, ikey.KindDel)
+	assert.Nil(c.CompactRange(nil, getKey(50), ikey.MaxSeq))
+	assert.Equal(1, c.NumLevel0Tables())
+	assert.Equal(100, countEntries(c, 1))
+	check(50)
+
+	// nothing in range.
+	assert.Nil(c.CompactRange(getKey(150), getKey(200), ikey.MaxSeq))
+	assert.Equal(1, c.NumLevel0Tables())
+
+	assert.Nil(c.CompactRange(nil, nil, ikey.MaxSeq))
+	assert.Equal(0, c.NumLevel0Tables())
+	assert.Equal(200, countEntries(c, 1))
+	check(50)
+}
+
+func TestCompactEmptyTable(t *testing.T) {
+	assert := assert.New(t)
+	c := NewController(t.TempDir(), option.DefaultOption)
+
+	// the table without bounds written by an empty range tombstone.
+	addEmpty := func() {
+		table, err := c.tableWriter.WriteTable(0, c.tid.Add(1), memdb.New(option.DefaultOption.MemDBSize))
+		assert.Nil(err)
+		assert.Nil(table.GetMinKey())
+		c.handlers[0].addTables(table)
+		c.level0Tables.Store(int64(len(c.handlers[0].tables)))
+	}
+
+	addEmpty()
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	assert.Equal(0, c.NumLevel0Tables())
+
+	db := memdb.New(option.DefaultOption.MemDBSize)
+	for i := 0; i < 100; i++ {
+		db.Put(ikey.Make(getKey(i), 1, ikey.KindVal), getKey(i))
+	}
+	assert.Nil(c.AddLevel0Table(db))
+	addEmpty()
+	assert.Nil(c.CompactRange(getKey(10), getKey(20), ikey.MaxSeq))
+	assert.Equal(0, c.NumLevel0Tables())
+
+	addEmpty()
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	assert.Equal(0, c.NumLevel0Tables())
+	assert.Equal(100, countEntries(c, 1))
+}
+
+func TestCompactTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	// the entry is written with a larger MemDBSize.
+	opt := *option.DefaultOption
+	c := NewController(dir, &opt)
+	db := memdb.New(opt.MemDBSize)
+	db.Put(ikey.Make(getKey(0), 1, ikey.KindVal), bytes.Repeat([]byte("a"), 32*option.KB))
+	assert.Nil(c.AddLevel0Table(db))
+	assert.Nil(c.Close())
+
+	opt.MemDBSize = 16 * option.KB
+	c = NewController(dir, &opt)
+	assert.Nil(c.BuildFromDisk())
+	assert.ErrorIs(c.Compact(ikey.MaxSeq), memdb.ErrTooLarge)
+
+	// levels are not changed.
+	assert.Equal(1, c.NumLevel0Tables())
+	value, _, err := c.Get(getKey(0), ikey.MaxSeq)
+	assert.Nil(err)
+	assert.Len(value, 32*option.KB)
+	assert.Nil(c.Close())
+}
+
+// blockingOperator blocks merging until released.
+type blockingOperator struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (o blockingOperator) Merge(_, existing []byte, operands [][]byte) []byte {
+	close(o.started)
+	<-o.release
+	return existing
+}
+
+func TestCompactNotBlockReaders(t *testing.T) {
+	assert := assert.New(t)
+	op := blockingOperator{started: make(chan struct{}), release: make(chan struct{})}
+	opt := *option.DefaultOption
+	opt.MergeOperator = op
+	c := NewController(t.TempDir(), &opt)
+
+	db := memdb.New(opt.MemDBSize)
+	db.Put(ikey.Make(getKey(0), 1, ikey.KindVal), getKey(0))
+	db.Put(ikey.Make(getKey(1), 2, ikey.KindMerge), getKey(1))
+	assert.Nil(c.AddLevel0Table(db))
+
+	done := make(chan error)
+	go func() { done <- c.Compact(ikey.MaxSeq) }()
+	<-op.started
+
+	// readers and flushes are not blocked during merging.
+	value, _, err := c.Get(getKey(0), ikey.MaxSeq)
+	assert.Nil(err)
+	assert.Equal(getKey(0), value)
+
+	db = memdb.New(opt.MemDBSize)
+	db.Put(ikey.Make(getKey(2), 3, ikey.KindVal), getKey(2))
+	assert.Nil(c.AddLevel0Table(db))
+
+	close(op.release)
+	assert.Nil(<-done)
+
+	// the table added during compaction is kept in level0.
+	assert.Equal(1, c.NumLevel0Tables())
+	assert.Equal(2, countEntries(c, 1))
+	value, _, err = c.Get(getKey(2), ikey.MaxSeq)
+	assert.Nil(err)
+	assert.Equal(getKey(2), value)
+}
+
+func TestCompactBlob(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	opt := *option.DefaultOption
+	opt.MinBlobSize = 64
+	c := NewController(dir, &opt)
+
+	const num = 1000
+
+	// values of multiples of 10 are small.
+	getValue := func(i, version int) []byte {
+		if i%10 == 0 {
+			return []byte(fmt.Sprintf("%d-%d", i, version))
+		}
+		return []byte(fmt.Sprintf("%064d-%d", i, version))
+	}
+	blobFiles := func() []string {
+		paths, _ := filepath.Glob(filepath.Join(dir, "*.blob"))
+		return paths
+	}
+	check := func(c *Controller, version func(i int) int) {
+		for i := 0; i < num; i++ {
+			value, kind, err := c.Get(getKey(i), ikey.MaxSeq)
+			assert.Nil(err)
+			assert.Equal(ikey.KindVal, kind)
+			assert.Equal(getValue(i, version(i)), value)
+		}
+
+		iters, _ := c.NewIterators(nil, nil)
+		it := iterator.NewMergingIterator(iters...)
+		// only the newest version of each key is checked.
+		var i int
+		var prev []byte
+		for it.First(); it.Valid(); it.Next() {
+			if bytes.Equal(prev, it.Key().UserKey()) {
+				continue
+			}
+			prev = append(prev[:0], it.Key().UserKey()...)
+			assert.Equal(getKey(i), prev)
+			assert.Equal(ikey.KindVal, it.Key().Kind())
+			assert.Equal(getValue(i, version(i)), it.Value())
+			i++
+		}
+		assert.Nil(it.Close())
+		assert.Equal(num, i)
+	}
+
+	db := memdb.New(opt.MemDBSize)
+	for i := 0; i < num; i++ {
+		db.Put(ikey.Make(getKey(i), 1, ikey.KindVal), getValue(i, 1))
+	}
+	assert.Nil(c.AddLevel0Table(db))
+	assert.Equal(1, len(blobFiles()))
+
+	// large values are stored as pointers.
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	it := newLevelIterator(c.handlers[1].tables, nil, nil)
+	var blobs int
+	for it.First(); it.Valid(); it.Next() {
+		if it.Key().Kind() == ikey.KindBlob {
+			blobs++
+		}
+	}
+	assert.Nil(it.Close())
+	assert.Equal(num*9/10, blobs)
+	check(c, func(int) int { return 1 })
+
+	// overwrite 60% of values, the old blob file is collected by the next compaction.
+	db = memdb.New(opt.MemDBSize)
+	for i := 0; i < num*6/10; i++ {
+		db.Put(ikey.Make(getKey(i), 2, ikey.KindVal), getValue(i, 2))
+	}
+	assert.Nil(c.AddLevel0Table(db))
+	version := func(i int) int {
+		if i < num*6/10 {
+			return 2
+		}
+		return 1
+	}
+	check(c, version)
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	assert.Equal(2, len(blobFiles()))
+	assert.Equal(map[uint64]bool{1: true}, c.blobsToCollect())
+
+	assert.Nil(c.Compact(ikey.MaxSeq))
+	_, err := os.Stat(blob.Path(dir, 1))
+	assert.True(os.IsNotExist(err))
+	assert.Equal(2, len(blobFiles()))
+	assert.Equal(0, len(c.blobsToCollect()))
+	check(c, version)
+
+	// reopen, the unused blob file is removed.
+	assert.Nil(c.Close())
+	assert.Nil(os.WriteFile(blob.Path(dir, 100), []byte("unused"), 0644))
+	c = NewController(dir, &opt)
+	assert.Nil(c.BuildFromDisk())
+	defer c.Close()
+	assert.Equal(2, len(blobFiles()))
+	check(c, version)
+}
@@ -3,8 +3,11 @@ package level
 import (
 	"bytes"
 	"cmp"
+	"errors"
 	"slices"
+	"sync"
 
+	"github.com/xgzlucario/LSM/ikey"
 	"github.com/xgzlucario/LSM/table"
 )
 
@@ -43,12 +46,108 @@ func (h *handler) sortTables() {
 	}
 }
 
-// findOverlapTables
-func (h *handler) findOverlapTables() (newTables, overlapTables []*table.Table) {
-	slices.SortFunc(h.tables, func(a, b *table.Table) int {
-		return bytes.Compare(a.GetMinKey(), b.GetMinKey())
+// findOverlapTables split tables by whether their user keys overlap with [minKey, maxKey].
+// level1+ only.
+func findOverlapTables(tables []*table.Table, minKey, maxKey ikey.Key) (newTables, overlapTables []*table.Table) {
+	for _, t := range tables {
+		if ikey.Key(t.GetMaxKey()).CompareUserKey(minKey) < 0 || ikey.Key(t.GetMinKey()).CompareUserKey(maxKey) > 0 {
+			newTables = append(newTables, t)
+		} else {
+			overlapTables = append(overlapTables, t)
+		}
+	}
+	return
+}
+
+// get find key in tables, level0 from newest to oldest, and level1+ by binary search.
+func (h *handler) get(key []byte, seq uint64) ([]byte, ikey.Kind, error) {
+	if h.level == 0 {
+		for i := len(h.tables) - 1; i >= 0; i-- {
+			value, kind, err := h.tables[i].FindKey(key, seq)
+			if errors.Is(err, table.ErrKeyNotFound) {
+				continue
+			}
+			return value, kind, err
+		}
+		return nil, 0, table.ErrKeyNotFound
+	}
+
+	// level1+ tables are sorted and not overlapping.
+	lookup := ikey.Make(key, seq, ikey.KindSeek)
+	i, _ := slices.BinarySearchFunc(h.tables, lookup, func(t *table.Table, lookup ikey.Key) int {
+		return bytes.Compare(t.GetMaxKey(), lookup)
 	})
+	if i == len(h.tables) {
+		return nil, 0, table.ErrKeyNotFound
+	}
+	return h.tables[i].FindKey(key, seq)
+}
+
+// multiGet finds the lookups in tables of the level, which are sorted by key and not found yet.
+// level1+ tables are searched concurrently if parallel is set.
+func (h *handler) multiGet(lookups []*Lookup, seq uint64, parallel bool) error {
+	if h.level == 0 {
+		for i := len(h.tables) - 1; i >= 0 && len(lookups) > 0; i-- {
+			if err := findLookups(h.tables[i], lookups, seq); err != nil {
+				return err
+			}
+			lookups = notFound(lookups)
+		}
+		return nil
+	}
 
-	// find overlap tables.
-	return nil, h.tables
+	// level1+ tables are sorted and not overlapping, so the lookups of each table are contiguous.
+	var wg sync.WaitGroup
+	errs := make([]error, len(h.tables))
+	for len(lookups) > 0 {
+		lookup := ikey.Make(lookups[0].Key, seq, ikey.KindSeek)
+		i, _ := slices.BinarySearchFunc(h.tables, lookup, func(t *table.Table, lookup ikey.Key) int {
+			return bytes.Compare(t.GetMaxKey(), lookup)
+		})
+		if i == len(h.tables) {
+			break
+		}
+		maxKey := h.tables[i].GetMaxKey()
+		n := 1
+		for n < len(lookups) && bytes.Compare(ikey.Make(lookups[n].Key, seq, ikey.KindSeek), maxKey) <= 0 {
+			n++
+		}
+
+		if parallel {
+			wg.Add(1)
+			go func(i int, lookups []*Lookup) {
+				defer wg.Done()
+				errs[i] = findLookups(h.tables[i], lookups, seq)
+			}(i, lookups[:n])
+		} else {
+			errs[i] = findLookups(h.tables[i], lookups[:n], seq)
+		}
+		lookups = lookups[n:]
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// notFound return the lookups not found yet.
+func notFound(lookups []*Lookup) []*Lookup {
+	res := make([]*Lookup, 0, len(lookups))
+	for _, l := range lookups {
+		if !l.Found {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+// findLookups finds the lookups in table t.
+func findLookups(t *table.Table, lookups []*Lookup, seq uint64) error {
+	keys := make([][]byte, len(lookups))
+	for i, l := range lookups {
+		keys[i] = l.Key
+	}
+	return t.FindKeys(keys, seq, func(i int, value []byte, kind ikey.Kind) {
+		l := lookups[i]
+		l.Value, l.Kind, l.Found = value, kind, true
+	})
 }
@@ -0,0 +1,171 @@
+package level
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/iterator"
+	"github.com/xgzlucario/LSM/rangedel"
+	"github.com/xgzlucario/LSM/table"
+)
+
+// levelIterator concatenates the sorted and not overlapping tables of level1+,
+// table iterators are opened on demand.
+type levelIterator struct {
+	tables []*table.Table
+	lower  ikey.Key
+	upper  ikey.Key
+	index  int
+	iter   *table.Iterator
+	errs   []error
+}
+
+// newLevelIterator return an iterator of tables in [lower, upper),
+// which are referenced until the iterator is closed.
+func newLevelIterator(tables []*table.Table, lower, upper ikey.Key) *levelIterator {
+	l := &levelIterator{lower: lower, upper: upper, index: -1}
+	for _, t := range tables {
+		if t.Overlaps(lower, upper) {
+			t.AddRef()
+			l.tables = append(l.tables, t)
+		}
+	}
+	return l
+}
+
+// First
+func (l *levelIterator) First() {
+	if l.setTable(0) {
+		l.iter.First()
+	}
+}
+
+// Last
+func (l *levelIterator) Last() {
+	if l.setTable(len(l.tables) - 1) {
+		l.iter.Last()
+	}
+}
+
+// Seek
+func (l *levelIterator) Seek(key ikey.Key) {
+	i, _ := slices.BinarySearchFunc(l.tables, key, func(t *table.Table, key ikey.Key) int {
+		return bytes.Compare(t.GetMaxKey(), key)
+	})
+	if l.setTable(i) {
+		l.iter.Seek(key)
+	}
+}
+
+// Next
+func (l *levelIterator) Next() {
+	l.iter.Next()
+	if !l.iter.Valid() && l.iter.Error() == nil && l.setTable(l.index+1) {
+		l.iter.First()
+	}
+}
+
+// Prev
+func (l *levelIterator) Prev() {
+	l.iter.Prev()
+	if !l.iter.Valid() && l.iter.Error() == nil && l.setTable(l.index-1) {
+		l.iter.Last()
+	}
+}
+
+// Valid
+func (l *levelIterator) Valid() bool {
+	return l.iter != nil && l.iter.Valid()
+}
+
+// Key
+func (l *levelIterator) Key() ikey.Key {
+	return l.iter.Key()
+}
+
+// Value
+func (l *levelIterator) Value() []byte {
+	return l.iter.Value()
+}
+
+// Expire
+func (l *levelIterator) Expire() int64 {
+	return l.iter.Expire()
+}
+
+// Error
+func (l *levelIterator) Error() error {
+	if l.iter != nil && l.iter.Error() != nil {
+		return l.iter.Error()
+	}
+	return errors.Join(l.errs...)
+}
+
+// Close
+func (l *levelIterator) Close() error {
+	l.setTable(-1)
+	for _, t := range l.tables {
+		t.DelRef()
+	}
+	l.tables = nil
+	return errors.Join(l.errs...)
+}
+
+// setTable open the iterator of table i and close the previous one,
+// return false if i is out of range.
+func (l *levelIterator) setTable(i int) bool {
+	if i == l.index && l.iter != nil {
+		return true
+	}
+	if l.iter != nil {
+		if err := l.iter.Close(); err != nil {
+			l.errs = append(l.errs, err)
+		}
+		l.iter = nil
+	}
+	l.index = i
+	if i < 0 || i >= len(l.tables) {
+		return false
+	}
+	l.iter = l.tables[i].NewIterator(l.lower, l.upper)
+	return true
+}
+
+// NewIterators return the iterators of tables which may contain keys in [lower, upper),
+// level0 tables from newest to oldest, and then a concatenating iterator for each level1+,
+// with the fragments of range tombstones of these tables. the values in blob files are read by the iterators.
+// the tables are referenced until the iterators are closed.
+func (c *Controller) NewIterators(lower, upper ikey.Key) ([]iterator.Iterator, rangedel.Set) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var iters []iterator.Iterator
+	var set rangedel.Set
+	for _, handler := range c.handlers {
+		if handler.level == 0 {
+			for i := len(handler.tables) - 1; i >= 0; i-- {
+				if t := handler.tables[i]; t.Overlaps(lower, upper) {
+					iters = append(iters, c.newBlobIterator(t.NewIterator(lower, upper)))
+					if frags := t.Fragments(); len(frags) > 0 {
+						set = append(set, frags)
+					}
+				}
+			}
+		} else if l := newLevelIterator(handler.tables, lower, upper); len(l.tables) > 0 {
+			iters = append(iters, c.newBlobIterator(l))
+
+			// tombstones of level1+ are clipped to the user keys of each table,
+			// so the fragments of tables are still sorted and not overlapping.
+			var frags rangedel.Fragments
+			for _, t := range l.tables {
+				frags = append(frags, t.Fragments()...)
+			}
+			if len(frags) > 0 {
+				set = append(set, frags)
+			}
+		}
+	}
+	return iters, set
+}
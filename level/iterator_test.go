@@ -0,0 +1,58 @@
+package level
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/option"
+)
+
+func TestLevelIteratorBounds(t *testing.T) {
+	assert := assert.New(t)
+	opt := *option.DefaultOption
+	opt.MemDBSize = 64 * option.KB
+	opt.DataBlockSize = 1 * option.KB
+	c := NewController(t.TempDir(), &opt)
+
+	const num = 10000
+
+	db := memdb.New(16 * option.MB)
+	for i := 0; i < num; i++ {
+		db.Put(ikey.Make(getKey(i), 1, ikey.KindVal), getKey(i))
+	}
+	assert.Nil(c.AddLevel0Table(db))
+	assert.Nil(c.Compact(ikey.MaxSeq))
+
+	lower := ikey.Make(getKey(4000), ikey.MaxSeq, ikey.KindSeek)
+	upper := ikey.Make(getKey(6000), ikey.MaxSeq, ikey.KindSeek)
+
+	// tables outside the bounds are skipped.
+	it := newLevelIterator(c.handlers[1].tables, lower, upper)
+	defer it.Close()
+	assert.Less(len(it.tables), len(c.handlers[1].tables))
+
+	// data blocks outside the bounds are skipped.
+	var count int
+	for it.First(); it.Valid(); it.Next() {
+		count++
+	}
+	assert.GreaterOrEqual(count, 2000)
+	assert.Less(count, 2100)
+
+	count = 0
+	for it.Last(); it.Valid(); it.Prev() {
+		count++
+	}
+	assert.GreaterOrEqual(count, 2000)
+	assert.Less(count, 2100)
+
+	// all keys in bounds are found.
+	for i := 4000; i < 6000; i++ {
+		key := ikey.Make(getKey(i), 1, ikey.KindVal)
+		it.Seek(key)
+		assert.Equal(key, it.Key())
+	}
+	assert.Nil(it.Error())
+}
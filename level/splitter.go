@@ -0,0 +1,81 @@
+package level
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/xgzlucario/LSM/blob"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/rangedel"
+	"github.com/xgzlucario/LSM/table"
+)
+
+// splitter splits compacted entries into tables of the same level.
+type splitter struct {
+	c      *Controller
+	level  int
+	db     *memdb.DB
+	tables []*table.Table
+
+	// writer is owned by the splitter, since level0 tables may be added during compaction.
+	writer *table.Writer
+
+	// rangeDels is the retained range tombstones, which are clipped to the user keys of each table,
+	// so that tables of the level do not overlap. the output level is the last level,
+	// so tombstones only need to cover the entries of the tables.
+	rangeDels rangedel.List
+}
+
+// newSplitter
+func (c *Controller) newSplitter(level int) *splitter {
+	return &splitter{
+		c:      c,
+		level:  level,
+		db:     memdb.New(c.opt.MemDBSize),
+		writer: table.NewWriter(c.dir, c.opt),
+	}
+}
+
+// add put entry to memdb, and dump it into a new table when memdb is full.
+func (s *splitter) add(key ikey.Key, value []byte, expire int64) error {
+	if s.db.PutWithExpire(key, value, expire) {
+		if err := s.flush(); err != nil {
+			return err
+		}
+		// e.g. the entry written with a larger MemDBSize before.
+		if s.db.PutWithExpire(key, value, expire) {
+			return fmt.Errorf("%w: key %s", memdb.ErrTooLarge, key)
+		}
+	}
+	return nil
+}
+
+// flush dump memdb into a new table if it is not empty.
+func (s *splitter) flush() error {
+	minKey, maxKey := s.db.MinKey(), s.db.MaxKey()
+	if minKey == nil {
+		return nil
+	}
+	maxUserKey := maxKey.UserKey()
+	end := append(maxUserKey[:len(maxUserKey):len(maxUserKey)], 0)
+	for _, t := range s.rangeDels {
+		if t, ok := t.Clip(minKey.UserKey(), end); ok {
+			s.db.PutRangeDel(t)
+		}
+	}
+
+	table, err := s.writer.WriteTable(s.level, s.c.tid.Add(1), s.db)
+	if err != nil {
+		return err
+	}
+	if err := s.c.refBlobs(table); err != nil {
+		table.Remove()
+		os.Remove(blob.Path(s.c.dir, table.ID()))
+		return err
+	}
+	s.tables = append(s.tables, table)
+	s.db.Reset()
+
+	return nil
+}
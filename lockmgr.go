@@ -0,0 +1,104 @@
+package lsm
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLockTimeout = errors.New("lsm: lock wait timeout")
+	ErrDeadlock    = errors.New("lsm: deadlock detected")
+)
+
+// lockManager grants exclusive locks of user keys to transactions.
+// A deadlock is detected by the wait-for graph, in which a transaction waits for one key at a time.
+type lockManager struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+
+	// waitFor is the key which a transaction is waiting for.
+	waitFor map[uint64]string
+}
+
+// keyLock is held by owner, released is closed when it is unlocked.
+type keyLock struct {
+	owner    uint64
+	released chan struct{}
+}
+
+// newLockManager
+func newLockManager() *lockManager {
+	return &lockManager{
+		locks:   make(map[string]*keyLock),
+		waitFor: make(map[uint64]string),
+	}
+}
+
+// lock acquires the lock of key for transaction id, it is reentrant and
+// return true if the lock is newly acquired.
+func (m *lockManager) lock(id uint64, key string, timeout time.Duration) (bool, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		l := m.locks[key]
+		if l == nil {
+			m.locks[key] = &keyLock{owner: id, released: make(chan struct{})}
+			return true, nil
+		}
+		if l.owner == id {
+			return false, nil
+		}
+		if m.deadlock(id, l.owner) {
+			return false, ErrDeadlock
+		}
+
+		m.waitFor[id] = key
+		m.mu.Unlock()
+
+		select {
+		case <-l.released:
+			m.mu.Lock()
+			delete(m.waitFor, id)
+
+		case <-timer.C:
+			m.mu.Lock()
+			delete(m.waitFor, id)
+			return false, ErrLockTimeout
+		}
+	}
+}
+
+// deadlock return true if waiting for owner makes a cycle in the wait-for graph.
+func (m *lockManager) deadlock(id, owner uint64) bool {
+	// the path is no longer than the number of waiting transactions.
+	for i := 0; owner != id; i++ {
+		key, ok := m.waitFor[owner]
+		if !ok || i > len(m.waitFor) {
+			return false
+		}
+		l := m.locks[key]
+		if l == nil {
+			return false
+		}
+		owner = l.owner
+	}
+	return true
+}
+
+// unlock releases the locks of keys held by transaction id.
+func (m *lockManager) unlock(id uint64, keys []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if l := m.locks[key]; l != nil && l.owner == id {
+			delete(m.locks, key)
+			close(l.released)
+		}
+	}
+}
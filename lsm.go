@@ -1,17 +1,33 @@
 package lsm
 
 import (
+	"bytes"
+	"container/list"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"slices"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
+	"github.com/xgzlucario/LSM/ikey"
 	"github.com/xgzlucario/LSM/level"
 	"github.com/xgzlucario/LSM/memdb"
 	"github.com/xgzlucario/LSM/option"
 	"github.com/xgzlucario/LSM/table"
+	"github.com/xgzlucario/LSM/wal"
+)
+
+var (
+	ErrKeyNotFound = errors.New("lsm: key not found")
+	ErrTooLarge    = errors.New("lsm: key-value pair is too large")
+
+	ErrNoMergeOperator = errors.New("lsm: merge operator is not set")
+	ErrClosed          = errors.New("lsm: closed")
+	ErrBackground      = errors.New("lsm: background error")
 )
 
 // LSM-Tree defination.
@@ -23,17 +39,60 @@ type LSM struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	// guards db and dbList.
-	mu     sync.RWMutex
-	db     *memdb.DB
-	dbList []*memdb.DB
+	// wg waits for the background goroutines.
+	wg sync.WaitGroup
+
+	// closed is set with writeMu held, so that no write is in progress after it.
+	closed atomic.Bool
+
+	// serializes writers, so that transactions are validated and written atomically.
+	writeMu sync.Mutex
+
+	// writers is the queue of concurrent writes, see WriteWithOptions.
+	queueMu   sync.Mutex
+	queueCond *sync.Cond
+	writers   []*writer
+
+	// guards column families, their memdbs and log.
+	mu        sync.RWMutex
+	cfs       map[uint32]*ColumnFamily
+	defaultCF *ColumnFamily
+	nextCFID  uint32
 
-	// index controller.
-	index *level.Controller
+	// log is the write-ahead log of the active memdbs of all column families,
+	// it is written with writeMu held, and replaced with both writeMu and mu held.
+	log   *wal.Log
+	logID uint64
 
-	tableWriter *table.Writer
+	// seq is the last sequence number.
+	seq atomic.Uint64
+
+	// locks of pessimistic transactions, which are identified by txnID.
+	locks *lockManager
+	txnID atomic.Uint64
+
+	// guards snapshots, which are ordered by sequence number.
+	snapMu    sync.Mutex
+	snapshots list.List
 
 	compactC chan struct{}
+
+	// minorC and majorC trigger the background compactions before the interval.
+	// level0C is notified when tables are dumped to level0, which starts the interval of major compaction.
+	minorC  chan struct{}
+	majorC  chan struct{}
+	level0C chan struct{}
+
+	// stallCh is closed and replaced when flush or compaction is done, to wake the stalled writes.
+	stallMu    sync.Mutex
+	stallCh    chan struct{}
+	slowdowns  atomic.Uint64
+	stops      atomic.Uint64
+	stallNanos atomic.Int64
+
+	// bgErr is the sticky error of flush, compaction or log, writes fail with it until resumed.
+	errMu sync.Mutex
+	bgErr error
 }
 
 // NewLSM
@@ -44,106 +103,622 @@ func NewLSM(dir string, opt *option.Option) (*LSM, error) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	lsm := &LSM{
-		Option:      opt,
-		dir:         dir,
-		ctx:         ctx,
-		cancel:      cancel,
-		db:          memdb.New(opt.MemDBSize),
-		dbList:      make([]*memdb.DB, 0, 16),
-		index:       level.NewController(dir, opt),
-		tableWriter: table.NewWriter(opt),
-		compactC:    make(chan struct{}, 1),
-	}
-
-	// build index.
-	if err := lsm.index.BuildFromDisk(); err != nil {
-		panic(err)
-	}
-
-	// start minor compaction.
-	go func() {
-		for {
-			select {
-			case <-time.After(lsm.MinorCompactInterval):
-				lsm.MinorCompact()
-
-			case <-lsm.ctx.Done():
-				return
-			}
-		}
-	}()
+		Option:   opt,
+		dir:      dir,
+		ctx:      ctx,
+		cancel:   cancel,
+		cfs:      make(map[uint32]*ColumnFamily),
+		locks:    newLockManager(),
+		compactC: make(chan struct{}, 1),
+		minorC:   make(chan struct{}, 1),
+		majorC:   make(chan struct{}, 1),
+		level0C:  make(chan struct{}, 1),
+		stallCh:  make(chan struct{}),
+	}
+	lsm.queueCond = sync.NewCond(&lsm.queueMu)
 
-	// start major compaction.
-	go func() {
-		for {
-			select {
-			case <-time.After(lsm.MajorCompactInterval):
-				lsm.MajorCompact()
+	// build index of column families.
+	if err := lsm.openColumnFamilies(); err != nil {
+		lsm.closeFiles()
+		return nil, err
+	}
 
-			case <-lsm.ctx.Done():
-				return
-			}
-		}
-	}()
+	// replay logs.
+	for _, cf := range lsm.cfs {
+		lsm.seq.Store(max(lsm.seq.Load(), cf.index.MaxSeq()))
+	}
+	if err := lsm.recover(); err != nil {
+		lsm.closeFiles()
+		return nil, err
+	}
+
+	if !lsm.DisableAutoCompaction {
+		lsm.startCompaction()
+	}
 
 	fmt.Println("LSM-Tree started.")
 
 	return lsm, nil
 }
 
+// startCompaction starts the background compactions, memdbs replayed from logs are dumped at once.
+func (lsm *LSM) startCompaction() {
+	notify(lsm.minorC)
+
+	lsm.wg.Add(2)
+	go lsm.compactLoop(lsm.minorC, nil, lsm.MinorCompactInterval, lsm.MinorCompact, lsm.hasImmutable)
+	go lsm.compactLoop(lsm.majorC, lsm.level0C, lsm.MajorCompactInterval, lsm.MajorCompact, lsm.hasLevel0)
+}
+
+// compactLoop runs compact when c is notified, or the interval passed since pending work is found
+// after the last run or when wake is notified. the idle LSM is not woken up by the interval.
+func (lsm *LSM) compactLoop(c, wake chan struct{}, interval time.Duration, compact func() error, pending func() bool) {
+	defer lsm.wg.Done()
+
+	// nil timer never fires.
+	var timer <-chan time.Time
+	arm := func() {
+		timer = nil
+		if pending() {
+			timer = time.After(interval)
+		}
+	}
+	arm()
+	for {
+		select {
+		case <-c:
+		case <-timer:
+		case <-wake:
+			if timer == nil {
+				arm()
+			}
+			continue
+		case <-lsm.ctx.Done():
+			return
+		}
+		lsm.background(compact)
+		arm()
+	}
+}
+
+// hasImmutable return true if there is any immutable memdb to be dumped.
+func (lsm *LSM) hasImmutable() bool {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+	for _, cf := range lsm.cfs {
+		if len(cf.dbList) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasLevel0 return true if there is any level0 table to be compacted.
+func (lsm *LSM) hasLevel0() bool {
+	for _, cf := range lsm.columnFamilies() {
+		if cf.index.CompactionPending() {
+			return true
+		}
+	}
+	return false
+}
+
 // Put
-func (lsm *LSM) Put(key, value []byte) {
-	// memdb is full.
-	if lsm.db.Put(key, value, 1) {
-		lsm.mu.Lock()
-		lsm.dbList = append(lsm.dbList, lsm.db)
-		lsm.db = memdb.New(lsm.MemDBSize)
+func (lsm *LSM) Put(key, value []byte) error {
+	var batch WriteBatch
+	batch.Put(key, value)
+	return lsm.Write(&batch)
+}
+
+// PutWithTTL puts a value which expires after ttl, the expired key is hidden on read
+// and dropped by compaction.
+func (lsm *LSM) PutWithTTL(key, value []byte, ttl time.Duration) error {
+	var batch WriteBatch
+	batch.PutWithTTL(key, value, ttl)
+	return lsm.Write(&batch)
+}
+
+// Delete records a tombstone of key.
+func (lsm *LSM) Delete(key []byte) error {
+	var batch WriteBatch
+	batch.Delete(key)
+	return lsm.Write(&batch)
+}
+
+// DeleteRange records a range tombstone, which deletes all keys in [start, end).
+func (lsm *LSM) DeleteRange(start, end []byte) error {
+	var batch WriteBatch
+	batch.DeleteRange(start, end)
+	return lsm.Write(&batch)
+}
+
+// Merge records a merge operand of key, which is merged into the existing value
+// by option.MergeOperator lazily on read.
+func (lsm *LSM) Merge(key, operand []byte) error {
+	var batch WriteBatch
+	batch.Merge(key, operand)
+	return lsm.Write(&batch)
+}
+
+// PutContext is Put which gives up waiting for the write stall when ctx is done.
+func (lsm *LSM) PutContext(ctx context.Context, key, value []byte) error {
+	var batch WriteBatch
+	batch.Put(key, value)
+	return lsm.WriteContext(ctx, &batch)
+}
+
+// Write applies the batch atomically, it is written to log as a single record first,
+// and then to memdb. Readers never observe a part of the batch.
+// the write is delayed or blocked when flush or compaction falls behind.
+func (lsm *LSM) Write(batch *WriteBatch) error {
+	return lsm.WriteContext(context.Background(), batch)
+}
+
+// WriteContext is Write which gives up waiting for the write stall when ctx is done.
+func (lsm *LSM) WriteContext(ctx context.Context, batch *WriteBatch) error {
+	return lsm.WriteWithOptions(ctx, batch, nil)
+}
+
+// write applies the batch, and syncs the log before applying if sync is set.
+// lsm.writeMu must be held.
+func (lsm *LSM) write(batch *WriteBatch, sync bool) error {
+	if lsm.closed.Load() {
+		return ErrClosed
+	}
+	if batch.Len() == 0 {
+		return nil
+	}
+	if batch.tooLarge {
+		return ErrTooLarge
+	}
+	if err := lsm.BackgroundError(); err != nil {
+		return err
+	}
+
+	// memdbs are swapped with mu held, and then the batch is applied with mu read-locked,
+	// so that readers are not blocked. memdbs support concurrent readers with a writer,
+	// and writers are serialized by writeMu, which guards the log.
+	lsm.mu.Lock()
+	sizes, err := lsm.batchSizes(batch)
+	if err != nil {
 		lsm.mu.Unlock()
+		return err
+	}
+
+	// rotate memdbs in advance, so that the whole batch is put into the same memdb of each column family.
+	for cf, size := range sizes {
+		if size <= cf.db.Free() {
+			continue
+		}
+		if err := lsm.rotate(); err != nil {
+			lsm.mu.Unlock()
+			return err
+		}
+		// dump the full memdbs at once.
+		notify(lsm.minorC)
+		break
+	}
+	for cf, size := range sizes {
+		if size > cf.db.Free() {
+			lsm.mu.Unlock()
+			return ErrTooLarge
+		}
+	}
+	lsm.mu.Unlock()
+
+	seq := lsm.seq.Load() + 1
+	batch.setSeq(seq)
+
+	// the log may be left with a partial record, which is dropped by rotating in Resume.
+	if err := lsm.log.Write(batch.Dump()); err != nil {
+		return lsm.setBackgroundError(err)
+	}
+	if sync {
+		if err := lsm.log.Sync(); err != nil {
+			return lsm.setBackgroundError(err)
+		}
+	}
+
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+	// the batch is logged but partially applied.
+	if err := lsm.apply(batch); err != nil {
+		return lsm.setBackgroundError(err)
+	}
+	// make the batch visible.
+	lsm.seq.Store(seq + uint64(batch.Len()) - 1)
+
+	return nil
+}
+
+// Get find value by key, from memdb, immutable memdbs to sstables.
+// the search stops at the newest entry or range tombstone of key, ErrKeyNotFound is returned
+// if it is a tombstone.
+func (lsm *LSM) Get(key []byte) ([]byte, error) {
+	return lsm.defaultCF.get(key, lsm.seq.Load())
+}
+
+// get find value by key, entries with sequence number greater than seq are invisible.
+func (cf *ColumnFamily) get(key []byte, seq uint64) ([]byte, error) {
+	lsm := cf.lsm
+	if lsm.closed.Load() {
+		return nil, ErrClosed
+	}
+	lsm.mu.RLock()
+	if lsm.cfs[cf.id] != cf {
+		lsm.mu.RUnlock()
+		return nil, ErrColumnFamilyNotFound
+	}
+	// find in memdb.
+	value, kind, ok := cf.db.Get(key, seq)
+
+	// find in immutable memdbs from newest to oldest.
+	for i := len(cf.dbList) - 1; !ok && i >= 0; i-- {
+		value, kind, ok = cf.dbList[i].Get(key, seq)
+	}
+	lsm.mu.RUnlock()
+
+	// find in sstables.
+	if !ok {
+		var err error
+		value, kind, err = cf.index.Get(key, seq)
+		// the levels are released if cf is dropped concurrently.
+		if cf.dropped() {
+			return nil, ErrColumnFamilyNotFound
+		}
+		if errors.Is(err, table.ErrKeyNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch kind {
+	case ikey.KindDel:
+		return nil, ErrKeyNotFound
+	case ikey.KindMerge:
+		return cf.getMerged(key, seq)
+	}
+	return slices.Clone(value), nil
+}
+
+// getMerged find value by key whose newest entry is a merge operand,
+// the operands are merged by iterator.
+func (cf *ColumnFamily) getMerged(key []byte, seq uint64) ([]byte, error) {
+	it := cf.lsm.newIterator(cf, seq, &IterOptions{LowerBound: key, UpperBound: append(slices.Clip(key), 0)})
+	it.First()
 
-		lsm.db.Put(key, value, 1)
+	var value []byte
+	valid := it.Valid()
+	if valid {
+		value = slices.Clone(it.Value())
 	}
+	if err := it.Close(); err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, ErrKeyNotFound
+	}
+	return value, nil
+}
+
+// MultiGetOptions
+type MultiGetOptions struct {
+	// Parallel searches the tables of each level concurrently.
+	Parallel bool
+}
+
+// MultiGet is Get of keys, values[i] and errs[i] are the result of keys[i].
+func (lsm *LSM) MultiGet(keys [][]byte) (values [][]byte, errs []error) {
+	return lsm.defaultCF.multiGet(keys, lsm.seq.Load(), nil)
+}
+
+// MultiGetWithOptions is MultiGet with options.
+func (lsm *LSM) MultiGetWithOptions(keys [][]byte, opts *MultiGetOptions) (values [][]byte, errs []error) {
+	return lsm.defaultCF.multiGet(keys, lsm.seq.Load(), opts)
+}
+
+// multiGet finds keys in sorted order, so that memdbs are searched once by all keys,
+// and the keys not found in memdbs are searched together in each level of sstables.
+func (cf *ColumnFamily) multiGet(keys [][]byte, seq uint64, opts *MultiGetOptions) ([][]byte, []error) {
+	if opts == nil {
+		opts = &MultiGetOptions{}
+	}
+	values := make([][]byte, len(keys))
+	errs := make([]error, len(keys))
+	fail := func(err error) ([][]byte, []error) {
+		for i := range errs {
+			errs[i] = err
+		}
+		return values, errs
+	}
+
+	lsm := cf.lsm
+	if lsm.closed.Load() {
+		return fail(ErrClosed)
+	}
+
+	lookups := make([]*level.Lookup, len(keys))
+	for i, key := range keys {
+		lookups[i] = &level.Lookup{Key: key}
+	}
+	sorted := slices.Clone(lookups)
+	slices.SortFunc(sorted, func(a, b *level.Lookup) int { return bytes.Compare(a.Key, b.Key) })
+
+	// find in memdb and immutable memdbs from newest to oldest.
+	lsm.mu.RLock()
+	if lsm.cfs[cf.id] != cf {
+		lsm.mu.RUnlock()
+		return fail(ErrColumnFamilyNotFound)
+	}
+	dbs := append([]*memdb.DB{cf.db}, cf.dbList...)
+	slices.Reverse(dbs[1:])
+	for _, db := range dbs {
+		for _, l := range sorted {
+			if !l.Found {
+				l.Value, l.Kind, l.Found = db.Get(l.Key, seq)
+			}
+		}
+	}
+	lsm.mu.RUnlock()
+
+	// find in sstables.
+	err := cf.index.MultiGet(sorted, seq, opts.Parallel)
+	// the levels are released if cf is dropped concurrently.
+	if cf.dropped() {
+		return fail(ErrColumnFamilyNotFound)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	for i, l := range lookups {
+		switch {
+		case !l.Found || l.Kind == ikey.KindDel:
+			errs[i] = ErrKeyNotFound
+		case l.Kind == ikey.KindMerge:
+			values[i], errs[i] = cf.getMerged(l.Key, seq)
+		default:
+			values[i] = slices.Clone(l.Value)
+		}
+	}
+	return values, errs
 }
 
-// Close
+// Close stops writes and background compaction, dumps the memdbs to level0,
+// and then closes the tables and log. Iterators must be closed before it.
 func (lsm *LSM) Close() error {
-	select {
-	case <-lsm.ctx.Done():
+	lsm.writeMu.Lock()
+	if lsm.closed.Load() {
+		lsm.writeMu.Unlock()
+		return nil
+	}
+	lsm.closed.Store(true)
+	lsm.writeMu.Unlock()
+
+	// wait for the running compaction.
+	lsm.cancel()
+	lsm.wg.Wait()
+
+	// the memdbs are kept in logs if failed to dump.
+	lsm.mu.Lock()
+	err := lsm.rotate()
+	lsm.mu.Unlock()
+	if err == nil {
+		err = lsm.flush()
+	}
+
+	return errors.Join(err, lsm.closeFiles())
+}
+
+// closeFiles closes the tables of column families and log.
+func (lsm *LSM) closeFiles() error {
+	lsm.mu.Lock()
+	defer lsm.mu.Unlock()
+
+	var err error
+	for _, cf := range lsm.cfs {
+		err = errors.Join(err, cf.index.Close())
+	}
+	if lsm.log != nil {
+		err = errors.Join(err, lsm.log.Close())
+	}
+	return err
+}
+
+// BackgroundError return the sticky error of flush, compaction or log, nil if there is none.
+// writes fail with it until Resume succeeds.
+func (lsm *LSM) BackgroundError() error {
+	lsm.errMu.Lock()
+	defer lsm.errMu.Unlock()
+	return lsm.bgErr
+}
+
+// setBackgroundError records err as the background error, and return it.
+func (lsm *LSM) setBackgroundError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrBackground) {
+		err = fmt.Errorf("%w: %w", ErrBackground, err)
+	}
+	lsm.errMu.Lock()
+	lsm.bgErr = err
+	lsm.errMu.Unlock()
+	lsm.wakeStalled()
+	return err
+}
+
+// Resume clears the background error after the memdbs are dumped with a new log successfully,
+// so that the log which may be left with a partial record is removed.
+func (lsm *LSM) Resume() error {
+	lsm.writeMu.Lock()
+	defer lsm.writeMu.Unlock()
+
+	if lsm.closed.Load() {
+		return ErrClosed
+	}
+	if lsm.BackgroundError() == nil {
 		return nil
-	default:
-		lsm.cancel()
 	}
+
+	lsm.mu.Lock()
+	err := lsm.rotate()
+	lsm.mu.Unlock()
+	if err == nil {
+		err = lsm.flush()
+	}
+	if err != nil {
+		return lsm.setBackgroundError(err)
+	}
+
+	lsm.errMu.Lock()
+	lsm.bgErr = nil
+	lsm.errMu.Unlock()
 	return nil
 }
 
-// MinorCompact
-func (lsm *LSM) MinorCompact() {
+// background runs the compaction unless there is a background error,
+// the transient error like ENOSPC is resumed first if option.AutoResume is set.
+func (lsm *LSM) background(compact func() error) {
+	if err := lsm.BackgroundError(); err != nil {
+		if !lsm.AutoResume || !errors.Is(err, syscall.ENOSPC) {
+			return
+		}
+		if lsm.Resume() != nil {
+			return
+		}
+	}
+	compact()
+}
+
+// MinorCompact dumps the immutable memdbs of all column families to level0,
+// and then removes the logs of them. the error is recorded as the background error.
+func (lsm *LSM) MinorCompact() error {
+	return lsm.setBackgroundError(lsm.flush())
+}
+
+// flush is MinorCompact without recording the error.
+func (lsm *LSM) flush() error {
 	lsm.compactC <- struct{}{}
+	defer func() { <-lsm.compactC }()
+
+	lsm.mu.RLock()
+	// the logs before the active log are persisted after dumping.
+	logID := lsm.logID
+	lists := make(map[*ColumnFamily][]*memdb.DB, len(lsm.cfs))
+	for _, cf := range lsm.cfs {
+		lists[cf] = slices.Clone(cf.dbList)
+	}
+	lsm.mu.RUnlock()
 
+	var err error
+	dumped := make(map[*ColumnFamily]int, len(lists))
+	for cf, list := range lists {
+		for _, db := range list {
+			if err = cf.index.AddLevel0Table(db); err != nil {
+				break
+			}
+			dumped[cf]++
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	// remove dumped memdbs until they can be found in level0,
+	// so that they are not dumped again on retry.
 	lsm.mu.Lock()
-	// need dump list.
-	list := slices.Clone(lsm.dbList)
-	lsm.dbList = lsm.dbList[:0]
+	for cf, n := range dumped {
+		cf.dbList = slices.Delete(cf.dbList, 0, n)
+	}
 	lsm.mu.Unlock()
+	lsm.wakeStalled()
+	if len(dumped) > 0 {
+		notify(lsm.level0C)
+	}
+	if err != nil {
+		return err
+	}
 
-	for _, db := range list {
-		if err := lsm.index.AddLevel0Table(db); err != nil {
-			panic(err)
+	if err := lsm.removeLogs(logID); err != nil {
+		return err
+	}
+	if len(dumped) > 0 {
+		for _, cf := range lsm.columnFamilies() {
+			cf.index.Print()
 		}
 	}
-	lsm.index.Print()
+	return nil
+}
 
-	<-lsm.compactC
+// Flush makes the active memdbs of all column families immutable and dumps them to level0.
+// it waits for the dump if wait is set, otherwise the dump is done by background compaction.
+func (lsm *LSM) Flush(wait bool) error {
+	lsm.writeMu.Lock()
+	if lsm.closed.Load() {
+		lsm.writeMu.Unlock()
+		return ErrClosed
+	}
+	err := lsm.BackgroundError()
+	if err == nil {
+		err = lsm.rotateNonEmpty()
+	}
+	lsm.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if !wait {
+		notify(lsm.minorC)
+		return nil
+	}
+	return lsm.MinorCompact()
 }
 
-// MajorCompact
-func (lsm *LSM) MajorCompact() {
+// MajorCompact compacts level0 into level1 of all column families.
+// the error is recorded as the background error.
+func (lsm *LSM) MajorCompact() error {
 	lsm.compactC <- struct{}{}
-	start := time.Now()
+	defer func() { <-lsm.compactC }()
+	defer lsm.wakeStalled()
 
-	if err := lsm.index.Compact(); err != nil {
-		panic(err)
+	smallestSeq := lsm.smallestSeq()
+	for _, cf := range lsm.columnFamilies() {
+		if err := cf.index.Compact(smallestSeq); err != nil {
+			return lsm.setBackgroundError(err)
+		}
 	}
+	return nil
+}
+
+// CompactRange flushes the memdbs, and then compacts the tables of default column family
+// overlapping user keys [start, end) into the bottom level, nil means unbounded.
+// the error is recorded as the background error.
+func (lsm *LSM) CompactRange(start, end []byte) error {
+	return lsm.defaultCF.CompactRange(start, end)
+}
+
+// CompactRange is LSM.CompactRange of column family.
+func (cf *ColumnFamily) CompactRange(start, end []byte) error {
+	lsm := cf.lsm
+	if err := lsm.Flush(true); err != nil {
+		return err
+	}
+	if start != nil && end != nil && bytes.Compare(start, end) >= 0 {
+		return nil
+	}
+
+	lsm.compactC <- struct{}{}
+	defer func() { <-lsm.compactC }()
+	defer lsm.wakeStalled()
 
-	fmt.Println("major compact cost:", time.Since(start))
-	<-lsm.compactC
+	if cf.dropped() {
+		return ErrColumnFamilyNotFound
+	}
+	if err := cf.index.CompactRange(start, end, lsm.smallestSeq()); err != nil {
+		return lsm.setBackgroundError(err)
+	}
+	return nil
 }
@@ -0,0 +1,1003 @@
+package lsm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/option"
+)
+
+var (
+	nilBytes []byte
+)
+
+func getKey(i int) []byte {
+	return []byte(fmt.Sprintf("%08d", i))
+}
+
+func getValue(i, version int) []byte {
+	return []byte(fmt.Sprintf("%08d-%d", i, version))
+}
+
+// testOption returns an option which disables background compactions and write stalls,
+// so that tests can trigger them manually.
+func testOption() *option.Option {
+	opt := *option.DefaultOption
+	opt.MemDBSize = 64 * option.KB
+	opt.DataBlockSize = 1 * option.KB
+	opt.DisableAutoCompaction = true
+	opt.MaxImmutableMemDBs = 0
+	opt.Level0SlowdownTables = 0
+	opt.Level0StopTables = 0
+	return &opt
+}
+
+func newTestLSM(t *testing.T, dir string) *LSM {
+	lsm, err := NewLSM(dir, testOption())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lsm
+}
+
+func checkGet(lsm *LSM, start, end, version int, assert *assert.Assertions) {
+	for i := start; i < end; i++ {
+		value, err := lsm.Get(getKey(i))
+		assert.Nil(err)
+		assert.Equal(getValue(i, version), value)
+	}
+}
+
+func TestGet(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	// put in reverse order.
+	for i := num - 1; i >= 0; i-- {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	assert.Greater(len(lsm.defaultCF.dbList), 0)
+
+	// find in memdb and immutable memdbs.
+	checkGet(lsm, 0, num, 0, assert)
+
+	value, err := lsm.Get(getKey(num))
+	assert.Equal(nilBytes, value)
+	assert.ErrorIs(err, ErrKeyNotFound)
+
+	// find in level0.
+	lsm.MinorCompact()
+	assert.Equal(0, len(lsm.defaultCF.dbList))
+	checkGet(lsm, 0, num, 0, assert)
+
+	// find in level1.
+	lsm.MajorCompact()
+	checkGet(lsm, 0, num, 0, assert)
+
+	// overwrite half of keys, newer value wins.
+	for i := 0; i < num/2; i++ {
+		lsm.Put(getKey(i), getValue(i, 1))
+	}
+	checkGet(lsm, 0, num/2, 1, assert)
+	checkGet(lsm, num/2, num, 0, assert)
+
+	lsm.MinorCompact()
+	checkGet(lsm, 0, num/2, 1, assert)
+	checkGet(lsm, num/2, num, 0, assert)
+
+	lsm.MajorCompact()
+	checkGet(lsm, 0, num/2, 1, assert)
+	checkGet(lsm, num/2, num, 0, assert)
+
+	for i := num; i < num*2; i++ {
+		value, err := lsm.Get(getKey(i))
+		assert.Equal(nilBytes, value)
+		assert.ErrorIs(err, ErrKeyNotFound)
+	}
+}
+
+func TestGetFromDisk(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	const num = 10000
+
+	lsm := newTestLSM(t, dir)
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+
+	for i := 0; i < num/2; i++ {
+		lsm.Put(getKey(i), getValue(i, 1))
+	}
+	// dump the active memdb.
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	seq := lsm.seq.Load()
+	lsm.Close()
+
+	// reopen, sequence number is restored from tables.
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	assert.Equal(seq, lsm.seq.Load())
+
+	checkGet(lsm, 0, num/2, 1, assert)
+	checkGet(lsm, num/2, num, 0, assert)
+}
+
+func TestFlush(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	opt := testOption()
+	opt.DisableAutoCompaction = false
+	opt.MinorCompactInterval = time.Hour
+	opt.MajorCompactInterval = time.Hour
+	lsm, err := NewLSM(dir, opt)
+	assert.Nil(err)
+
+	const num = 10000
+
+	// full memdbs are dumped at once.
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	flushed := func() bool {
+		lsm.mu.RLock()
+		defer lsm.mu.RUnlock()
+		return len(lsm.defaultCF.dbList) == 0
+	}
+	assert.Eventually(flushed, time.Second, time.Millisecond)
+	assert.Greater(lsm.defaultCF.index.NumLevel0Tables(), 0)
+
+	// dump the active memdb in background.
+	assert.Nil(lsm.Flush(false))
+	assert.Eventually(flushed, time.Second, time.Millisecond)
+	assert.True(lsm.defaultCF.db.Empty())
+	assert.Nil(lsm.Close())
+
+	// dump and wait.
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	checkGet(lsm, 0, num, 0, assert)
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 1)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Equal(0, len(lsm.defaultCF.dbList))
+	assert.True(lsm.defaultCF.db.Empty())
+	checkGet(lsm, 0, num, 1, assert)
+
+	// nothing to dump.
+	logID := lsm.logID
+	assert.Nil(lsm.Flush(true))
+	assert.Equal(logID, lsm.logID)
+	logs, _ := filepath.Glob(filepath.Join(dir, "*"+logExt))
+	assert.Equal(1, len(logs))
+}
+
+func TestMultiGet(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	// level1.
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+
+	// level0.
+	for i := 0; i < num; i += 3 {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 1)))
+	}
+	assert.Nil(lsm.DeleteRange(getKey(100), getKey(200)))
+	assert.Nil(lsm.Flush(true))
+
+	// memdbs.
+	for i := 0; i < num; i += 5 {
+		assert.Nil(lsm.Delete(getKey(i)))
+	}
+	assert.Nil(lsm.rotate())
+	for i := 0; i < num; i += 7 {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 2)))
+	}
+
+	// keys in reverse order with missing and duplicate keys.
+	var keys [][]byte
+	for i := num + 100; i >= 0; i-- {
+		keys = append(keys, getKey(i))
+	}
+	keys = append(keys, getKey(0), getKey(1))
+
+	for _, opts := range []*MultiGetOptions{nil, {Parallel: true}} {
+		values, errs := lsm.MultiGetWithOptions(keys, opts)
+		assert.Equal(len(keys), len(values))
+		for i, key := range keys {
+			value, err := lsm.Get(key)
+			assert.Equal(err, errs[i])
+			assert.Equal(value, values[i])
+		}
+	}
+	value, err := lsm.Get(getKey(7))
+	assert.Nil(err)
+	assert.Equal(getValue(7, 2), value)
+	_, err = lsm.Get(getKey(150))
+	assert.ErrorIs(err, ErrKeyNotFound)
+}
+
+func TestCompactRange(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+
+	// the level0 table out of range is not compacted.
+	for i := num; i < num+100; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	assert.Nil(lsm.Flush(true))
+
+	// the space of deleted keys is reclaimed, and the memdbs are flushed before.
+	assert.Nil(lsm.DeleteRange(getKey(0), getKey(num/2)))
+	assert.Nil(lsm.CompactRange(getKey(0), getKey(num/2)))
+	assert.True(lsm.defaultCF.db.Empty())
+	assert.Equal(1, lsm.defaultCF.index.NumLevel0Tables())
+	assert.InDelta(num/2+100, lsm.ApproximateCount(nil, nil), num/20)
+
+	for i := 0; i < num/2; i++ {
+		_, err := lsm.Get(getKey(i))
+		assert.ErrorIs(err, ErrKeyNotFound)
+	}
+	checkGet(lsm, num/2, num+100, 0, assert)
+
+	// column family.
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+	assert.Nil(users.Put(getKey(0), getValue(0, 0)))
+	assert.Nil(users.CompactRange(nil, nil))
+	assert.Equal(0, users.index.NumLevel0Tables())
+	value, err := users.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal(getValue(0, 0), value)
+
+	assert.Nil(lsm.DropColumnFamily(users))
+	assert.ErrorIs(users.CompactRange(nil, nil), ErrColumnFamilyNotFound)
+}
+
+func TestBlob(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	opt := testOption()
+	opt.MinBlobSize = 64
+	opt.MergeOperator = addOperator{}
+	lsm, err := NewLSM(dir, opt)
+	assert.Nil(err)
+
+	const num = 10000
+
+	// large values are counters, which are separated to blob files.
+	getBlobValue := func(i int) []byte {
+		return []byte(fmt.Sprintf("%0100d", i))
+	}
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getBlobValue(i)))
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+	blobs, _ := filepath.Glob(filepath.Join(dir, "*.blob"))
+	assert.Greater(len(blobs), 0)
+
+	// merge with values in blob files.
+	for i := 0; i < num; i += 2 {
+		assert.Nil(lsm.Merge(getKey(i), []byte("1")))
+	}
+	expected := func(i int) []byte {
+		if i%2 == 0 {
+			return []byte(strconv.Itoa(i + 1))
+		}
+		return getBlobValue(i)
+	}
+	check := func() {
+		for i := 0; i < num; i++ {
+			value, err := lsm.Get(getKey(i))
+			assert.Nil(err)
+			assert.Equal(expected(i), value)
+		}
+
+		it := lsm.NewIterator(nil)
+		var i int
+		for it.First(); it.Valid(); it.Next() {
+			assert.Equal(getKey(i), it.Key())
+			assert.Equal(expected(i), it.Value())
+			i++
+		}
+		assert.Nil(it.Close())
+		assert.Equal(num, i)
+
+		keys := make([][]byte, num)
+		for i := range keys {
+			keys[i] = getKey(i)
+		}
+		values, errs := lsm.MultiGet(keys)
+		for i := range keys {
+			assert.Nil(errs[i])
+			assert.Equal(expected(i), values[i])
+		}
+	}
+	check()
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+	check()
+	assert.Nil(lsm.Close())
+
+	// reopen, the unused blob file is removed.
+	unused := filepath.Join(dir, "99999999.blob")
+	assert.Nil(os.WriteFile(unused, []byte("unused"), 0644))
+	lsm, err = NewLSM(dir, opt)
+	assert.Nil(err)
+	defer lsm.Close()
+	_, err = os.Stat(unused)
+	assert.True(os.IsNotExist(err))
+	check()
+}
+
+func TestBlobTooLarge(t *testing.T) {
+	assert := assert.New(t)
+
+	// values are limited by memdb even with blob separation.
+	opt := testOption()
+	opt.MemDBSize = option.MB
+	opt.MinBlobSize = 64
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	value := bytes.Repeat([]byte("a"), math.MaxUint16)
+	assert.Nil(lsm.Put(getKey(0), value))
+	assert.ErrorIs(lsm.Put(getKey(1), append(value, 'a')), ErrTooLarge)
+
+	assert.Nil(lsm.Flush(true))
+	v, err := lsm.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal(value, v)
+	_, err = lsm.Get(getKey(1))
+	assert.ErrorIs(err, ErrKeyNotFound)
+}
+
+func TestDelete(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	lsm := newTestLSM(t, dir)
+
+	const num = 10000
+
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+
+	checkDeleted := func() {
+		for i := 0; i < num; i++ {
+			value, err := lsm.Get(getKey(i))
+			if i%2 == 0 {
+				assert.Equal(nilBytes, value)
+				assert.ErrorIs(err, ErrKeyNotFound)
+			} else {
+				assert.Nil(err)
+				assert.Equal(getValue(i, 0), value)
+			}
+		}
+	}
+
+	// delete even keys.
+	for i := 0; i < num; i += 2 {
+		lsm.Delete(getKey(i))
+	}
+	checkDeleted()
+
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	checkDeleted()
+
+	lsm.MajorCompact()
+	checkDeleted()
+	lsm.Close()
+
+	// reopen.
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	checkDeleted()
+
+	// put again.
+	lsm.Put(getKey(0), getValue(0, 1))
+	value, err := lsm.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal(getValue(0, 1), value)
+}
+
+func TestDeleteRange(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	lsm := newTestLSM(t, dir)
+
+	const num = 10000
+	const start, end = 2000, 6000
+
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+
+	// overwrite some keys in level0.
+	for i := 0; i < num; i += 10 {
+		lsm.Put(getKey(i), getValue(i, 1))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+
+	snap := lsm.NewSnapshot()
+	assert.Nil(lsm.DeleteRange(getKey(start), getKey(end)))
+	// keys put after the range tombstone are visible.
+	for i := start; i < end; i += 100 {
+		lsm.Put(getKey(i), getValue(i, 2))
+	}
+
+	deleted := func(i int) bool {
+		return i >= start && i < end && i%100 != 0
+	}
+	checkData := func() {
+		for i := 0; i < num; i++ {
+			value, err := lsm.Get(getKey(i))
+			switch {
+			case deleted(i):
+				assert.ErrorIs(err, ErrKeyNotFound)
+			case i >= start && i < end:
+				assert.Equal(getValue(i, 2), value)
+			case i%10 == 0:
+				assert.Equal(getValue(i, 1), value)
+			default:
+				assert.Equal(getValue(i, 0), value)
+			}
+		}
+
+		it := lsm.NewIterator(nil)
+		defer it.Close()
+
+		var count int
+		for it.First(); it.Valid(); it.Next() {
+			count++
+		}
+		assert.Equal(num-(end-start)+(end-start)/100, count)
+
+		count = 0
+		for it.Last(); it.Valid(); it.Prev() {
+			count++
+		}
+		assert.Equal(num-(end-start)+(end-start)/100, count)
+	}
+	checkSnapshot := func() {
+		for i := start; i < end; i++ {
+			value, err := snap.Get(getKey(i))
+			assert.Nil(err)
+			assert.Equal(getValue(i, 1-min(i%10, 1)), value)
+		}
+	}
+	checkData()
+	checkSnapshot()
+
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	checkData()
+	checkSnapshot()
+
+	// covered keys are retained for snapshot.
+	lsm.MajorCompact()
+	checkData()
+	checkSnapshot()
+
+	// covered keys are dropped.
+	snap.Release()
+	lsm.DeleteRange(getKey(num), getKey(num+1))
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+	checkData()
+	lsm.Close()
+
+	// reopen.
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	checkData()
+
+	// range tombstones are replayed from log.
+	assert.Nil(lsm.DeleteRange(getKey(0), getKey(start)))
+	lsm.cancel()
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	for i := 0; i < start; i++ {
+		_, err := lsm.Get(getKey(i))
+		assert.ErrorIs(err, ErrKeyNotFound)
+	}
+}
+
+func TestDeleteRangeEmpty(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	// the empty range is ignored.
+	assert.Nil(lsm.DeleteRange(getKey(1), getKey(0)))
+	assert.Nil(lsm.DeleteRange(getKey(1), getKey(1)))
+	assert.True(lsm.defaultCF.db.Empty())
+
+	lsm.Put(getKey(0), getValue(0, 0))
+	assert.Nil(lsm.Flush(true))
+	lsm.MajorCompact()
+
+	value, err := lsm.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal(getValue(0, 0), value)
+}
+
+func TestDeleteRangeRotate(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	// range tombstones fill up the memdb.
+	n := int(testOption().MemDBSize/memdb.EntrySize(getKey(0), getKey(1))) + 1
+	for i := 0; i < n; i++ {
+		assert.Nil(lsm.DeleteRange(getKey(i), getKey(i+1)))
+	}
+	lsm.mu.RLock()
+	assert.NotEmpty(lsm.defaultCF.dbList)
+	lsm.mu.RUnlock()
+}
+
+func TestPutWithTTL(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	lsm := newTestLSM(t, dir)
+
+	const num = 1000
+	const ttl = 200 * time.Millisecond
+
+	// odd keys expire, and even keys overwrite the old values with ttl.
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.PutWithTTL(getKey(i), getValue(i, 1), ttl))
+	}
+	for i := 0; i < num; i += 2 {
+		lsm.Put(getKey(i), getValue(i, 2))
+	}
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+
+	// the same key is put with ttl in memdb.
+	for i := 1; i < num; i += 4 {
+		assert.Nil(lsm.PutWithTTL(getKey(i), getValue(i, 3), time.Hour))
+	}
+	// replayed from log.
+	lsm.cancel()
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+
+	checkData := func(expired bool) {
+		for i := 0; i < num; i++ {
+			value, err := lsm.Get(getKey(i))
+			switch {
+			case i%2 == 0:
+				assert.Equal(getValue(i, 2), value)
+			case i%4 == 1:
+				assert.Equal(getValue(i, 3), value)
+			case expired:
+				assert.ErrorIs(err, ErrKeyNotFound)
+			default:
+				assert.Equal(getValue(i, 1), value)
+			}
+		}
+
+		count := num/2 + num/4
+		if !expired {
+			count = num
+		}
+		it := lsm.NewIterator(nil)
+		defer it.Close()
+		var n int
+		for it.First(); it.Valid(); it.Next() {
+			n++
+		}
+		assert.Equal(count, n)
+		n = 0
+		for it.Last(); it.Valid(); it.Prev() {
+			n++
+		}
+		assert.Equal(count, n)
+	}
+	checkData(false)
+
+	time.Sleep(ttl)
+	checkData(true)
+
+	// expired keys are dropped by compaction.
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+	checkData(true)
+}
+
+func TestRecover(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	const num = 10000
+
+	lsm := newTestLSM(t, dir)
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	for i := 0; i < num; i += 2 {
+		assert.Nil(lsm.Delete(getKey(i)))
+	}
+	for i := 1; i < num/2; i += 2 {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 1)))
+	}
+	assert.Greater(len(lsm.defaultCF.dbList), 0)
+
+	checkData := func() {
+		for i := 0; i < num; i++ {
+			value, err := lsm.Get(getKey(i))
+			if i%2 == 0 {
+				assert.Equal(nilBytes, value)
+				assert.ErrorIs(err, ErrKeyNotFound)
+			} else if i < num/2 {
+				assert.Nil(err)
+				assert.Equal(getValue(i, 1), value)
+			} else {
+				assert.Nil(err)
+				assert.Equal(getValue(i, 0), value)
+			}
+		}
+	}
+
+	// the process crashed before memdbs dumped.
+	seq := lsm.seq.Load()
+	lsm.cancel()
+	lsm = newTestLSM(t, dir)
+	assert.Equal(seq, lsm.seq.Load())
+	checkData()
+
+	// logs are removed after memdbs dumped.
+	lsm.MinorCompact()
+	logs, _ := filepath.Glob(filepath.Join(dir, "*"+logExt))
+	assert.Equal(1, len(logs))
+	assert.Equal(lsm.log.Path(), logs[0])
+	checkData()
+
+	// the partial table left by a crash is removed.
+	tmp := filepath.Join(dir, "99999999.sst.tmp")
+	assert.Nil(os.WriteFile(tmp, []byte("partial"), 0644))
+	lsm.cancel()
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	checkData()
+	assert.NoFileExists(tmp)
+
+	// too large.
+	assert.ErrorIs(lsm.Put(getKey(0), make([]byte, 64*option.KB)), ErrTooLarge)
+}
+
+func TestClose(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	// compaction is running in background.
+	opt := testOption()
+	opt.MinorCompactInterval = time.Millisecond
+	opt.MajorCompactInterval = time.Millisecond
+	opt.DisableAutoCompaction = false
+	lsm, err := NewLSM(dir, opt)
+	assert.Nil(err)
+
+	const num = 10000
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+	}
+	it := lsm.NewIterator(nil)
+	it.First()
+	assert.True(it.Valid())
+	assert.Nil(it.Close())
+	assert.Nil(lsm.Close())
+	assert.Nil(lsm.Close())
+
+	// writes and reads are rejected.
+	assert.ErrorIs(lsm.Put(getKey(0), nil), ErrClosed)
+	_, err = lsm.Get(getKey(0))
+	assert.ErrorIs(err, ErrClosed)
+	it = lsm.NewIterator(nil)
+	it.First()
+	assert.False(it.Valid())
+	assert.ErrorIs(it.Close(), ErrClosed)
+
+	// memdbs are dumped, only the empty log is left.
+	logs, _ := filepath.Glob(filepath.Join(dir, "*"+logExt))
+	assert.Equal(1, len(logs))
+	stat, err := os.Stat(logs[0])
+	assert.Nil(err)
+	assert.Equal(int64(0), stat.Size())
+
+	lsm = newTestLSM(t, dir)
+	defer lsm.Close()
+	assert.Equal(0, len(lsm.defaultCF.dbList))
+	checkGet(lsm, 0, num, 0, assert)
+}
+
+func TestBackgroundError(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	lsm := newTestLSM(t, dir)
+	defer lsm.Close()
+
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+
+	const num = 1000
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+		assert.Nil(users.Put(getKey(i), getValue(i, 0)))
+	}
+	checkUsers := func() {
+		for i := 0; i < num; i++ {
+			value, err := users.Get(getKey(i))
+			assert.Nil(err)
+			assert.Equal(getValue(i, 0), value)
+		}
+	}
+
+	// failed to dump, the memdbs are kept.
+	cfDir := filepath.Join(dir, "cf-1")
+	assert.Nil(os.RemoveAll(cfDir))
+	assert.Nil(lsm.rotate())
+	assert.NotNil(lsm.MinorCompact())
+	assert.ErrorIs(lsm.BackgroundError(), ErrBackground)
+	assert.Equal(1, len(users.dbList))
+
+	// writes fail with the sticky error, reads are served.
+	assert.ErrorIs(lsm.Put(getKey(0), nil), ErrBackground)
+	checkGet(lsm, 0, num, 0, assert)
+	checkUsers()
+
+	// resume after the failure is fixed.
+	assert.Nil(os.MkdirAll(cfDir, 0755))
+	assert.Nil(lsm.Resume())
+	assert.Nil(lsm.BackgroundError())
+	assert.Equal(0, len(users.dbList))
+	checkGet(lsm, 0, num, 0, assert)
+	checkUsers()
+
+	// failed to compact, the levels are not changed.
+	assert.Nil(os.RemoveAll(cfDir))
+	assert.NotNil(lsm.MajorCompact())
+	assert.ErrorIs(lsm.Put(getKey(0), nil), ErrBackground)
+	assert.Nil(os.MkdirAll(cfDir, 0755))
+	assert.Nil(lsm.Resume())
+	assert.Nil(lsm.MajorCompact())
+	checkGet(lsm, 0, num, 0, assert)
+	checkUsers()
+	assert.Nil(lsm.Put(getKey(0), getValue(0, 0)))
+}
+
+func TestAutoResume(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := testOption()
+	opt.MinorCompactInterval = time.Hour
+	opt.MajorCompactInterval = time.Hour
+	opt.DisableAutoCompaction = false
+	opt.AutoResume = true
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	// the transient error is resumed by the next background compaction.
+	lsm.setBackgroundError(syscall.ENOSPC)
+	assert.ErrorIs(lsm.Put(getKey(0), nil), syscall.ENOSPC)
+	notify(lsm.minorC)
+	assert.Eventually(func() bool { return lsm.BackgroundError() == nil }, time.Second, time.Millisecond)
+	assert.Nil(lsm.Put(getKey(0), getValue(0, 0)))
+
+	// the others are sticky.
+	lsm.setBackgroundError(os.ErrPermission)
+	notify(lsm.minorC)
+	time.Sleep(10 * time.Millisecond)
+	assert.ErrorIs(lsm.BackgroundError(), os.ErrPermission)
+}
+
+func TestCompactLoop(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	var runs atomic.Int64
+	var pending atomic.Bool
+	c, wake := make(chan struct{}, 1), make(chan struct{}, 1)
+	lsm.wg.Add(1)
+	go lsm.compactLoop(c, wake, time.Millisecond, func() error {
+		runs.Add(1)
+		return nil
+	}, pending.Load)
+
+	// the idle LSM is not woken up by the interval.
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(int64(0), runs.Load())
+
+	notify(c)
+	assert.Eventually(func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(int64(1), runs.Load())
+
+	// the interval starts when the pending work is found.
+	pending.Store(true)
+	notify(wake)
+	assert.Eventually(func() bool { return runs.Load() > 3 }, time.Second, time.Millisecond)
+
+	pending.Store(false)
+	time.Sleep(10 * time.Millisecond)
+	n := runs.Load()
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(n, runs.Load())
+}
+
+func TestConcurrent(t *testing.T) {
+	assert := assert.New(t)
+
+	// compaction is running in background.
+	opt := testOption()
+	opt.MinorCompactInterval = time.Millisecond
+	opt.MajorCompactInterval = time.Millisecond
+	opt.DisableAutoCompaction = false
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	const num = 10000
+	const writers = 4
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		// writer.
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < num; i += writers {
+				assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+			}
+		}(w)
+
+		// reader.
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < num; i += writers {
+				value, err := lsm.Get(getKey(i))
+				if err == nil {
+					assert.Equal(getValue(i, 0), value)
+				} else {
+					assert.ErrorIs(err, ErrKeyNotFound)
+				}
+			}
+			it := lsm.NewIterator(nil)
+			for it.First(); it.Valid(); it.Next() {
+			}
+			assert.Nil(it.Close())
+		}(w)
+	}
+	wg.Wait()
+
+	checkGet(lsm, 0, num, 0, assert)
+}
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 10000
+
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+	snap := lsm.NewSnapshot()
+
+	// overwrite and delete after snapshot.
+	for i := 0; i < num; i++ {
+		if i%2 == 0 {
+			lsm.Delete(getKey(i))
+		} else {
+			lsm.Put(getKey(i), getValue(i, 1))
+		}
+	}
+	for i := num; i < num*2; i++ {
+		lsm.Put(getKey(i), getValue(i, 1))
+	}
+	snap2 := lsm.NewSnapshot()
+	assert.Equal(snap.seq, lsm.smallestSeq())
+
+	checkSnapshot := func() {
+		for i := 0; i < num*2; i++ {
+			value, err := snap.Get(getKey(i))
+			if i < num {
+				assert.Nil(err)
+				assert.Equal(getValue(i, 0), value)
+			} else {
+				assert.ErrorIs(err, ErrKeyNotFound)
+			}
+
+			value, err = snap2.Get(getKey(i))
+			if i < num && i%2 == 0 {
+				assert.ErrorIs(err, ErrKeyNotFound)
+			} else {
+				assert.Nil(err)
+				assert.Equal(getValue(i, 1), value)
+			}
+		}
+	}
+	checkSnapshot()
+
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	checkSnapshot()
+
+	lsm.MajorCompact()
+	checkSnapshot()
+
+	// release.
+	snap.Release()
+	snap.Release()
+	assert.Equal(snap2.seq, lsm.smallestSeq())
+	snap2.Release()
+	assert.Equal(lsm.seq.Load(), lsm.smallestSeq())
+
+	lsm.MajorCompact()
+	for i := 0; i < num*2; i++ {
+		value, err := lsm.Get(getKey(i))
+		if i < num && i%2 == 0 {
+			assert.ErrorIs(err, ErrKeyNotFound)
+		} else {
+			assert.Nil(err)
+			assert.Equal(getValue(i, 1), value)
+		}
+	}
+}
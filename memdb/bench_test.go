@@ -3,6 +3,8 @@ package memdb
 import (
 	"fmt"
 	"testing"
+
+	"github.com/xgzlucario/LSM/ikey"
 )
 
 func BenchmarkPut(b *testing.B) {
@@ -10,7 +12,7 @@ func BenchmarkPut(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		k := []byte(fmt.Sprintf("%08d", i))
 
-		if db.Put(k, k, typeVal) {
+		if db.Put(ikey.Make(k, uint64(i), ikey.KindVal), k) {
 			db = New(testMemDBSize)
 		}
 	}
@@ -21,7 +23,7 @@ func BenchmarkPutReset(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		k := []byte(fmt.Sprintf("%08d", i))
 
-		if db.Put(k, k, typeVal) {
+		if db.Put(ikey.Make(k, uint64(i), ikey.KindVal), k) {
 			db.Reset()
 		}
 	}
@@ -31,12 +33,12 @@ func BenchmarkGet(b *testing.B) {
 	db := New(testMemDBSize)
 	for i := 0; i < 10000; i++ {
 		k := []byte(fmt.Sprintf("%08d", i))
-		db.Put(k, k, typeVal)
+		db.Put(ikey.Make(k, uint64(i), ikey.KindVal), k)
 	}
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
 		k := []byte(fmt.Sprintf("%08d", i))
-		db.Get(k)
+		db.Get(k, ikey.MaxSeq)
 	}
 }
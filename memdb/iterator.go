@@ -0,0 +1,76 @@
+package memdb
+
+import (
+	"github.com/andy-kimball/arenaskl"
+	"github.com/xgzlucario/LSM/ikey"
+)
+
+// Iterator iterates memdb in the order of internal key.
+type Iterator struct {
+	it arenaskl.Iterator
+}
+
+// NewIterator return an iterator of db, which is safe to use while db is being written,
+// but is invalid after db is reset.
+func (db *DB) NewIterator() *Iterator {
+	it := new(Iterator)
+	it.it.Init(db.skl)
+	return it
+}
+
+// First
+func (it *Iterator) First() {
+	it.it.SeekToFirst()
+}
+
+// Last
+func (it *Iterator) Last() {
+	it.it.SeekToLast()
+}
+
+// Seek
+func (it *Iterator) Seek(key ikey.Key) {
+	it.it.Seek(key)
+}
+
+// Next
+func (it *Iterator) Next() {
+	it.it.Next()
+}
+
+// Prev
+func (it *Iterator) Prev() {
+	it.it.Prev()
+}
+
+// Valid
+func (it *Iterator) Valid() bool {
+	return it.it.Valid()
+}
+
+// Key
+func (it *Iterator) Key() ikey.Key {
+	return it.it.Key()
+}
+
+// Value
+func (it *Iterator) Value() []byte {
+	value, _ := decodeValue(it.it.Value(), it.it.Meta())
+	return value
+}
+
+// Expire return the expiry unix nano timestamp of entry, 0 means never.
+func (it *Iterator) Expire() int64 {
+	_, expire := decodeValue(it.it.Value(), it.it.Meta())
+	return expire
+}
+
+// Error
+func (it *Iterator) Error() error {
+	return nil
+}
+
+// Close
+func (it *Iterator) Close() error {
+	return nil
+}
@@ -1,33 +1,53 @@
 package memdb
 
 import (
+	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/andy-kimball/arenaskl"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/rangedel"
 )
 
 const (
-	// key-value pair type.
-	typeVal uint16 = 1
-	typeDel uint16 = 2
+	// metaExpire is set in the meta of entry which has an expiry timestamp,
+	// which is stored before the value.
+	metaExpire uint16 = 1 << 0
+
+	// ExpireSize is the extra size taken by the expiry timestamp.
+	ExpireSize = 8
+)
+
+var (
+	// ErrTooLarge is returned when an entry does not fit in an empty memdb.
+	ErrTooLarge = errors.New("memdb: entry is too large")
 )
 
-// DB is the memory db of LSM-Tree.
+// DB is the memory db of LSM-Tree, keyed by internal key.
+// It is safe for concurrent use, except Reset. Each call uses its own iterator
+// of the lock-free skiplist, so that readers are not blocked by writers.
 type DB struct {
 	arena *arenaskl.Arena
 	skl   *arenaskl.Skiplist
-	it    *arenaskl.Iterator
+
+	// guards rangeDels, the size they take and their fragments,
+	// which are cached until the next tombstone is put.
+	mu           sync.RWMutex
+	rangeDels    rangedel.List
+	rangeDelSize uint32
+	frags        rangedel.Fragments
 }
 
 // New
 func New(cap uint32) *DB {
 	arena := arenaskl.NewArena(cap)
 	skl := arenaskl.NewSkiplist(arena)
-	var it arenaskl.Iterator
-	it.Init(skl)
-
-	return &DB{arena: arena, skl: skl, it: &it}
+	return &DB{arena: arena, skl: skl}
 }
 
 // New2 returns a db with a bit of redundant space.
@@ -43,45 +63,168 @@ func (db *DB) String() string {
 		db.Len(), db.Capacity(), db.MinKey(), db.MaxKey())
 }
 
-// Reset
+// Reset must not be called concurrently with the other methods.
 func (db *DB) Reset() {
 	db.arena.Reset()
 	db.skl = arenaskl.NewSkiplist(db.arena)
+
+	db.mu.Lock()
+	db.rangeDels, db.rangeDelSize, db.frags = nil, 0, nil
+	db.mu.Unlock()
 }
 
-// Get
-func (db *DB) Get(key []byte) ([]byte, bool) {
-	if db.seek(key) {
-		return db.it.Value(), true
+// Get return the newest value and kind of user key whose sequence number is not greater than seq.
+// KindDel is returned if it is deleted by a range tombstone or expired.
+func (db *DB) Get(key []byte, seq uint64) ([]byte, ikey.Kind, bool) {
+	delSeq := db.Fragments().MaxSeq(key, seq)
+
+	lookup := ikey.Make(key, seq, ikey.KindSeek)
+	it := db.iterator()
+	it.Seek(lookup)
+
+	if it.Valid() {
+		if k := ikey.Key(it.Key()); k.SameUserKey(lookup) && k.Seq() >= delSeq {
+			value, expire := decodeValue(it.Value(), it.Meta())
+			if expire != 0 && expire <= time.Now().UnixNano() {
+				return nil, ikey.KindDel, true
+			}
+			return value, k.Kind(), true
+		}
+	}
+	if delSeq > 0 {
+		return nil, ikey.KindDel, true
 	}
-	return nil, false
+	return nil, 0, false
+}
+
+// PutRangeDel ignores the empty range tombstone.
+// the tombstone takes the free size of db as an entry of its start and end.
+func (db *DB) PutRangeDel(t rangedel.Tombstone) {
+	if bytes.Compare(t.Start, t.End) >= 0 {
+		return
+	}
+	t.Start = slices.Clone(t.Start)
+	t.End = slices.Clone(t.End)
+
+	db.mu.Lock()
+	db.rangeDels = append(db.rangeDels, t)
+	db.rangeDelSize += EntrySize(t.Start, t.End)
+	db.frags = nil
+	db.mu.Unlock()
+}
+
+// RangeDels return the range tombstones of db.
+func (db *DB) RangeDels() rangedel.List {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return slices.Clip(db.rangeDels)
+}
+
+// Fragments return the fragments of the range tombstones of db.
+func (db *DB) Fragments() rangedel.Fragments {
+	db.mu.RLock()
+	frags, n := db.frags, len(db.rangeDels)
+	db.mu.RUnlock()
+	if frags != nil || n == 0 {
+		return frags
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.frags == nil {
+		db.frags = db.rangeDels.Fragment()
+	}
+	return db.frags
+}
+
+// Empty return true if there is no entry and range tombstone in db.
+func (db *DB) Empty() bool {
+	return db.MinKey() == nil && len(db.RangeDels()) == 0
 }
 
 // Len
 func (db *DB) Len() int {
 	var count int
-	for db.it.SeekToFirst(); db.it.Valid(); db.it.Next() {
+	it := db.iterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
 		count++
 	}
 	return count
 }
 
+// Approximate return the size and number of entries of user keys [start, end), nil means unbounded.
+func (db *DB) Approximate(start, end []byte) (size, count uint64) {
+	it := db.iterator()
+	if start != nil {
+		it.Seek(ikey.Make(start, ikey.MaxSeq, ikey.KindSeek))
+	} else {
+		it.SeekToFirst()
+	}
+	for ; it.Valid(); it.Next() {
+		if end != nil && bytes.Compare(ikey.Key(it.Key()).UserKey(), end) >= 0 {
+			break
+		}
+		size += uint64(len(it.Key()) + len(it.Value()))
+		count++
+	}
+	return size, count
+}
+
 // Capacity
 func (db *DB) Capacity() uint32 {
 	return db.arena.Cap()
 }
 
+// Free return the free size of arena, excluding the size taken by range tombstones.
+func (db *DB) Free() uint32 {
+	db.mu.RLock()
+	size, cap := db.arena.Size()+db.rangeDelSize, db.arena.Cap()
+	db.mu.RUnlock()
+	if size >= cap {
+		return 0
+	}
+	return cap - size
+}
+
+// EntrySize return the max size of arena taken by a user key-value pair,
+// including the internal key, the skiplist node and its alignment.
+// an entry with expiry takes ExpireSize more.
+func EntrySize(key, value []byte) uint32 {
+	return uint32(arenaskl.MaxNodeSize+8) + uint32(ikey.Size(key)+len(value))
+}
+
 // put
-func (db *DB) put(key, value []byte, meta uint16) error {
-	if db.seek(key) {
-		return db.it.Set(value, meta)
+func (db *DB) put(key ikey.Key, value []byte, expire int64) error {
+	var meta uint16
+	if expire != 0 {
+		buf := make([]byte, ExpireSize, ExpireSize+len(value))
+		binary.BigEndian.PutUint64(buf, uint64(expire))
+		value, meta = append(buf, value...), metaExpire
+	}
+	it := db.iterator()
+	for {
+		var err error
+		if it.Seek(key) {
+			err = it.Set(value, meta)
+		} else {
+			err = it.Add(key, value, meta)
+		}
+		// retry if the key is added or updated concurrently.
+		if !errors.Is(err, arenaskl.ErrRecordExists) && !errors.Is(err, arenaskl.ErrRecordUpdated) {
+			return err
+		}
 	}
-	return db.it.Add(key, value, meta)
 }
 
 // Put return true if memdb is full.
-func (db *DB) Put(key, value []byte, meta uint16) bool {
-	err := db.put(key, value, meta)
+func (db *DB) Put(key ikey.Key, value []byte) bool {
+	return db.PutWithExpire(key, value, 0)
+}
+
+// PutWithExpire puts an entry which expires at the unix nano timestamp, 0 means never.
+// it return true if memdb is full.
+func (db *DB) PutWithExpire(key ikey.Key, value []byte, expire int64) bool {
+	err := db.put(key, value, expire)
 	if err == nil {
 		return false
 	}
@@ -91,29 +234,48 @@ func (db *DB) Put(key, value []byte, meta uint16) bool {
 	panic("bug: put memdb error")
 }
 
-// MinKey
-func (db *DB) MinKey() []byte {
-	db.it.SeekToFirst()
-	return db.it.Key()
+// MinKey return nil if db is empty.
+func (db *DB) MinKey() ikey.Key {
+	it := db.iterator()
+	it.SeekToFirst()
+	if !it.Valid() {
+		return nil
+	}
+	return it.Key()
+}
+
+// MaxKey return nil if db is empty.
+func (db *DB) MaxKey() ikey.Key {
+	it := db.iterator()
+	it.SeekToLast()
+	if !it.Valid() {
+		return nil
+	}
+	return it.Key()
 }
 
-// MaxKey
-func (db *DB) MaxKey() []byte {
-	db.it.SeekToLast()
-	return db.it.Key()
+// Iter iterates all entries in the order of internal key, the expiry is not passed.
+func (db *DB) Iter(f func(key ikey.Key, value []byte)) {
+	it := db.iterator()
+	for it.SeekToFirst(); it.Valid(); it.Next() {
+		value, _ := decodeValue(it.Value(), it.Meta())
+		f(it.Key(), value)
+	}
 }
 
-// Iter
-func (db *DB) Iter(f func(key, value []byte, meta uint16)) {
-	for db.it.SeekToFirst(); db.it.Valid(); db.it.Next() {
-		f(db.it.Key(), db.it.Value(), db.it.Meta())
+// decodeValue splits the value stored in arena into the value and its expiry.
+func decodeValue(value []byte, meta uint16) ([]byte, int64) {
+	if meta&metaExpire == 0 {
+		return value, 0
 	}
+	return value[ExpireSize:], int64(binary.BigEndian.Uint64(value))
 }
 
-// seek
-func (db *DB) seek(key []byte) bool {
-	db.it.Seek(key)
-	return db.it.Valid()
+// iterator return a new skiplist iterator, which is owned by the caller.
+func (db *DB) iterator() *arenaskl.Iterator {
+	var it arenaskl.Iterator
+	it.Init(db.skl)
+	return &it
 }
 
 // Merge
@@ -124,13 +286,15 @@ func Merge(dbs ...*DB) *DB {
 	}
 	db := New2(cap)
 
-	// merge memdbs sequentially.
+	// versions of the same user key are distinguished by sequence number,
+	// so the order of memdbs does not matter.
 	for _, m := range dbs {
-		m.Iter(func(key, value []byte, meta uint16) {
-			if db.Put(key, value, meta) {
+		it := m.NewIterator()
+		for it.First(); it.Valid(); it.Next() {
+			if db.PutWithExpire(it.Key(), it.Value(), it.Expire()) {
 				panic("bug: merge memdb error")
 			}
-		})
+		}
 	}
 
 	return db
@@ -140,18 +304,19 @@ func Merge(dbs ...*DB) *DB {
 func (db *DB) SplitFunc(eachBlockSize uint32, cb func(*DB) error) error {
 	newdb := New(eachBlockSize)
 
-	db.Iter(func(key, value []byte, meta uint16) {
-		if newdb.Put(key, value, meta) {
+	it := db.NewIterator()
+	for it.First(); it.Valid(); it.Next() {
+		if newdb.PutWithExpire(it.Key(), it.Value(), it.Expire()) {
 			if err := cb(newdb); err != nil {
-				panic(err)
+				return err
 			}
 
 			newdb.Reset()
-			if newdb.Put(key, value, meta) {
+			if newdb.PutWithExpire(it.Key(), it.Value(), it.Expire()) {
 				panic("bug: put memdb error")
 			}
 		}
-	})
+	}
 
 	// dump last table.
 	return cb(newdb)
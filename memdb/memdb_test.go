@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/rangedel"
 )
 
 const (
@@ -25,7 +29,7 @@ func getMemDB(start, end int) *DB {
 	m := New(testMemDBSize)
 	for i := start; i < end; i++ {
 		k := getKey(i)
-		m.Put(k, k, typeVal)
+		m.Put(ikey.Make(k, uint64(i), ikey.KindVal), k)
 	}
 	return m
 }
@@ -34,13 +38,13 @@ func checkData(m *DB, start, end int, assert *assert.Assertions) {
 	// check minKey and maxKey.
 	minKey := fmt.Sprintf("%08d", start)
 	maxKey := fmt.Sprintf("%08d", end-1)
-	assert.Equal(minKey, string(m.MinKey()))
-	assert.Equal(maxKey, string(m.MaxKey()))
+	assert.Equal(minKey, string(m.MinKey().UserKey()))
+	assert.Equal(maxKey, string(m.MaxKey().UserKey()))
 
 	// check 0-start.
 	for i := 0; i < start; i++ {
 		k := getKey(i)
-		value, ok := m.Get(k)
+		value, _, ok := m.Get(k, ikey.MaxSeq)
 		assert.Equal(nilBytes, value)
 		assert.False(ok)
 	}
@@ -48,7 +52,7 @@ func checkData(m *DB, start, end int, assert *assert.Assertions) {
 	// check start-end.
 	for i := start; i < end; i++ {
 		k := getKey(i)
-		value, ok := m.Get(k)
+		value, _, ok := m.Get(k, ikey.MaxSeq)
 		assert.Equal(k, value)
 		assert.True(ok)
 	}
@@ -56,7 +60,7 @@ func checkData(m *DB, start, end int, assert *assert.Assertions) {
 	// check end-end*2.
 	for i := end; i < end*2; i++ {
 		k := getKey(i)
-		value, ok := m.Get(k)
+		value, _, ok := m.Get(k, ikey.MaxSeq)
 		assert.Equal(nilBytes, value)
 		assert.False(ok)
 	}
@@ -80,7 +84,7 @@ func TestGet(t *testing.T) {
 
 	for i := 0; i < 20000; i++ {
 		k := getKey(i)
-		value, ok := m.Get(k)
+		value, _, ok := m.Get(k, ikey.MaxSeq)
 
 		if i < 10000 {
 			assert.Equal(k, value)
@@ -94,22 +98,23 @@ func TestGet(t *testing.T) {
 
 func TestPutIfFull(t *testing.T) {
 	assert := assert.New(t)
-	m := New(1024)
+	// internal keys and random skiplist heights take extra space.
+	m := New(2048)
 
 	// check cap.
-	assert.Equal(uint32(1024), m.Capacity())
+	assert.Equal(uint32(2048), m.Capacity())
 
 	// ok.
 	for i := 0; i < 10; i++ {
 		k := []byte(strconv.Itoa(i))
-		full := m.Put(k, k, typeVal)
+		full := m.Put(ikey.Make(k, 1, ikey.KindVal), k)
 		assert.False(full)
 	}
 
 	// overflow.
 	for i := 0; i < 100; i++ {
 		k := []byte(strings.Repeat(strconv.Itoa(i), 1024))
-		full := m.Put(k, k, typeVal)
+		full := m.Put(ikey.Make(k, 1, ikey.KindVal), k)
 		assert.True(full)
 	}
 }
@@ -143,3 +148,197 @@ func TestMerge(t *testing.T) {
 		checkData(m1, 0, 17000, assert)
 	}
 }
+
+func TestPutReverse(t *testing.T) {
+	assert := assert.New(t)
+	m := New(testMemDBSize)
+
+	for i := 9999; i >= 0; i-- {
+		k := getKey(i)
+		m.Put(ikey.Make(k, 1, ikey.KindVal), k)
+	}
+	checkData(m, 0, 10000, assert)
+}
+
+func TestEntrySize(t *testing.T) {
+	assert := assert.New(t)
+	m := New(testMemDBSize)
+
+	for i := 0; ; i++ {
+		k := []byte(strings.Repeat(strconv.Itoa(i), i%100))
+		v := []byte(strings.Repeat(strconv.Itoa(i), i%1000))
+
+		free := m.Free()
+		if EntrySize(k, v) > free {
+			break
+		}
+		assert.False(m.Put(ikey.Make(k, uint64(i), ikey.KindVal), v))
+		assert.LessOrEqual(free-m.Free(), EntrySize(k, v))
+	}
+}
+
+func TestVersions(t *testing.T) {
+	assert := assert.New(t)
+	m := New(testMemDBSize)
+
+	k := []byte("key")
+	m.Put(ikey.Make(k, 2, ikey.KindVal), []byte("v2"))
+	m.Put(ikey.Make(k, 4, ikey.KindDel), nil)
+	m.Put(ikey.Make(k, 6, ikey.KindVal), []byte("v6"))
+	m.Put(ikey.Make([]byte("kez"), 3, ikey.KindVal), []byte("kez"))
+
+	for seq, want := range []string{"", "", "v2", "v2", "", "", "v6", "v6"} {
+		value, kind, ok := m.Get(k, uint64(seq))
+		switch {
+		case seq < 2:
+			assert.False(ok)
+		case want == "":
+			assert.True(ok)
+			assert.Equal(ikey.KindDel, kind)
+		default:
+			assert.True(ok)
+			assert.Equal(ikey.KindVal, kind)
+			assert.Equal(want, string(value))
+		}
+	}
+
+	// iterate by user key asc, seq desc.
+	var seqs []uint64
+	m.Iter(func(key ikey.Key, value []byte) {
+		seqs = append(seqs, key.Seq())
+	})
+	assert.Equal([]uint64{6, 4, 2, 3}, seqs)
+}
+
+func TestExpire(t *testing.T) {
+	assert := assert.New(t)
+	m := New(testMemDBSize)
+
+	k := []byte("key")
+	past, future := time.Now().Add(-time.Second).UnixNano(), time.Now().Add(time.Hour).UnixNano()
+	m.Put(ikey.Make(k, 1, ikey.KindVal), []byte("v1"))
+	m.PutWithExpire(ikey.Make(k, 2, ikey.KindVal), []byte("v2"), past)
+	m.PutWithExpire(ikey.Make(k, 3, ikey.KindVal), []byte("v3"), future)
+
+	for seq, want := range []string{"", "v1", "", "v3"} {
+		value, kind, ok := m.Get(k, uint64(seq))
+		switch {
+		case seq == 0:
+			assert.False(ok)
+		case want == "":
+			// expired.
+			assert.True(ok)
+			assert.Equal(ikey.KindDel, kind)
+		default:
+			assert.True(ok)
+			assert.Equal(ikey.KindVal, kind)
+			assert.Equal(want, string(value))
+		}
+	}
+
+	// values are iterated without expiry.
+	it := m.NewIterator()
+	var expires []int64
+	for it.First(); it.Valid(); it.Next() {
+		assert.Equal(fmt.Sprintf("v%d", it.Key().Seq()), string(it.Value()))
+		expires = append(expires, it.Expire())
+	}
+	assert.Equal([]int64{future, past, 0}, expires)
+
+	// expiry is kept by merge.
+	m = Merge(m, New(testMemDBSize))
+	_, kind, _ := m.Get(k, 2)
+	assert.Equal(ikey.KindDel, kind)
+}
+
+func TestRangeDel(t *testing.T) {
+	assert := assert.New(t)
+	m := New(testMemDBSize)
+	m.Put(ikey.Make(getKey(1), 1, ikey.KindVal), getKey(1))
+
+	// range tombstones take the free size.
+	free := m.Free()
+	m.PutRangeDel(rangedel.Tombstone{Start: getKey(0), End: getKey(2), Seq: 2})
+	assert.Equal(free-EntrySize(getKey(0), getKey(2)), m.Free())
+
+	// the empty range is ignored.
+	m.PutRangeDel(rangedel.Tombstone{Start: getKey(2), End: getKey(2), Seq: 3})
+	assert.Len(m.RangeDels(), 1)
+
+	_, kind, ok := m.Get(getKey(1), ikey.MaxSeq)
+	assert.True(ok)
+	assert.Equal(ikey.KindDel, kind)
+	value, _, _ := m.Get(getKey(1), 1)
+	assert.Equal(getKey(1), value)
+
+	// fragments are rebuilt after a tombstone is put.
+	m.Put(ikey.Make(getKey(3), 4, ikey.KindVal), getKey(3))
+	_, _, ok = m.Get(getKey(3), ikey.MaxSeq)
+	assert.True(ok)
+	m.PutRangeDel(rangedel.Tombstone{Start: getKey(3), End: getKey(4), Seq: 5})
+	_, kind, _ = m.Get(getKey(3), ikey.MaxSeq)
+	assert.Equal(ikey.KindDel, kind)
+	assert.Len(m.Fragments(), 2)
+
+	m.Reset()
+	assert.Equal(m.Capacity()-m.arena.Size(), m.Free())
+	assert.Empty(m.Fragments())
+}
+
+func TestConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	m := New(testMemDBSize)
+
+	const num = 10000
+	const writers = 4
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(2)
+		// writer.
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < num; i += writers {
+				k := getKey(i)
+				assert.False(m.Put(ikey.Make(k, uint64(i), ikey.KindVal), k))
+			}
+		}(w)
+
+		// reader.
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < num; i += writers {
+				k := getKey(i)
+				if value, _, ok := m.Get(k, ikey.MaxSeq); ok {
+					assert.Equal(k, value)
+				}
+				m.MinKey()
+				m.MaxKey()
+			}
+		}(w)
+	}
+
+	// the same key is put concurrently.
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.False(m.Put(ikey.Make([]byte("same"), 1, ikey.KindVal), getKey(i)))
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, _, ok := m.Get([]byte("same"), ikey.MaxSeq)
+	assert.True(ok)
+	assert.Equal(getKey(99), value)
+
+	assert.Equal(num+1, m.Len())
+	for i := 0; i < num; i++ {
+		k := getKey(i)
+		value, _, ok := m.Get(k, ikey.MaxSeq)
+		assert.True(ok)
+		assert.Equal(k, value)
+	}
+}
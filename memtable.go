@@ -0,0 +1,200 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/rangedel"
+	"github.com/xgzlucario/LSM/table"
+	"github.com/xgzlucario/LSM/wal"
+)
+
+const (
+	logExt = ".wal"
+)
+
+// apply puts all entries of batch into the active memdbs of column families,
+// the entries of dropped column families are skipped. lsm.mu must be held or read-locked
+// by the only writer. the entries after a full memdb are not put.
+func (lsm *LSM) apply(batch *WriteBatch) error {
+	seq := batch.seq()
+	var err error
+	iterErr := batch.iter(func(id uint32, key, value []byte, kind ikey.Kind) {
+		defer func() { seq++ }()
+
+		cf := lsm.cfs[id]
+		if cf == nil || err != nil {
+			return
+		}
+		db := cf.db
+
+		var full bool
+		switch kind {
+		case ikey.KindRangeDel:
+			db.PutRangeDel(rangedel.Tombstone{Start: key, End: value, Seq: seq})
+		case ikey.KindExpire:
+			expire := int64(binary.BigEndian.Uint64(value))
+			full = db.PutWithExpire(ikey.Make(key, seq, ikey.KindVal), value[memdb.ExpireSize:], expire)
+		default:
+			full = db.Put(ikey.Make(key, seq, kind), value)
+		}
+		// the space is checked by batchSizes before.
+		if full {
+			err = fmt.Errorf("%w: memdb of column family %d is full", ErrTooLarge, id)
+		}
+	})
+	return errors.Join(iterErr, err)
+}
+
+// logPath
+func (lsm *LSM) logPath(id uint64) string {
+	return filepath.Join(lsm.dir, fmt.Sprintf("%08d%s", id, logExt))
+}
+
+// rotate makes the active memdbs of all column families immutable, and creates a new log.
+// the empty memdbs are kept active. lsm.mu must be held, and no write is in progress.
+func (lsm *LSM) rotate() error {
+	log, err := wal.Create(lsm.logPath(lsm.logID + 1))
+	if err != nil {
+		return err
+	}
+	// sync the directory, so the new log is not lost on crash.
+	if err := table.SyncDir(lsm.dir); err != nil {
+		log.Close()
+		os.Remove(log.Path())
+		return err
+	}
+	lsm.logID++
+
+	if lsm.log != nil {
+		if err := lsm.log.Close(); err != nil {
+			log.Close()
+			return err
+		}
+	}
+	lsm.log = log
+
+	for _, cf := range lsm.cfs {
+		if !cf.db.Empty() {
+			cf.dbList = append(cf.dbList, cf.db)
+			cf.db = memdb.New(cf.opt.MemDBSize)
+		}
+	}
+	return nil
+}
+
+// rotateNonEmpty rotates if the active memdb of any column family is not empty.
+// lsm.writeMu must be held.
+func (lsm *LSM) rotateNonEmpty() error {
+	lsm.mu.Lock()
+	defer lsm.mu.Unlock()
+
+	for _, cf := range lsm.cfs {
+		if !cf.db.Empty() {
+			return lsm.rotate()
+		}
+	}
+	return nil
+}
+
+// logIDs return the ids of logs in dir, which are sorted.
+func (lsm *LSM) logIDs() ([]uint64, error) {
+	// logs are named by increasing id, so that they are sorted.
+	paths, err := filepath.Glob(filepath.Join(lsm.dir, "*"+logExt))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint64, 0, len(paths))
+	for _, path := range paths {
+		id, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), logExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// removeLogs removes the logs before id. the directories of column families are synced first,
+// so that the tables dumped from the logs are persisted before the logs are removed.
+func (lsm *LSM) removeLogs(id uint64) error {
+	ids, err := lsm.logIDs()
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 || ids[0] >= id {
+		return nil
+	}
+	for _, cf := range lsm.columnFamilies() {
+		if err := table.SyncDir(columnFamilyDir(lsm.dir, cf.id)); err != nil {
+			return err
+		}
+	}
+	for _, logID := range ids {
+		if logID >= id {
+			break
+		}
+		if err := os.Remove(lsm.logPath(logID)); err != nil {
+			return err
+		}
+	}
+	return table.SyncDir(lsm.dir)
+}
+
+// recover replays logs left by the last process into memdbs of column families,
+// and then makes them immutable with a new log.
+func (lsm *LSM) recover() error {
+	ids, err := lsm.logIDs()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		lsm.logID = max(lsm.logID, id)
+		path := lsm.logPath(id)
+		empty := true
+
+		err = wal.Replay(path, func(record []byte) error {
+			var batch WriteBatch
+			if err := batch.Load(record); err != nil {
+				return err
+			}
+			// the column family may be dropped or configured without merge operator now.
+			sizes, _ := lsm.batchSizes(&batch)
+			for cf, size := range sizes {
+				// memdb is full.
+				if size > cf.db.Free() {
+					cf.dbList = append(cf.dbList, cf.db)
+					cf.db = memdb.New(cf.opt.MemDBSize)
+
+					if size > cf.db.Free() {
+						return ErrTooLarge
+					}
+				}
+			}
+			empty = false
+			lsm.seq.Store(max(lsm.seq.Load(), batch.seq()+uint64(batch.Len())-1))
+
+			return lsm.apply(&batch)
+		})
+		if err != nil {
+			return err
+		}
+
+		if empty {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return lsm.rotate()
+}
@@ -0,0 +1,240 @@
+package lsm
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/option"
+)
+
+// addOperator treats values as decimal counters.
+type addOperator struct{}
+
+func (addOperator) Merge(_, existing []byte, operands [][]byte) []byte {
+	n, _ := strconv.Atoi(string(existing))
+	for _, op := range operands {
+		m, _ := strconv.Atoi(string(op))
+		n += m
+	}
+	return []byte(strconv.Itoa(n))
+}
+
+func TestMerge(t *testing.T) {
+	assert := assert.New(t)
+	opt := testOption()
+	opt.MergeOperator = addOperator{}
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	const num = 1000
+
+	// counter i is i+1 when finished, key 0 is deleted.
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), []byte(strconv.Itoa(i)))
+	}
+	lsm.Delete(getKey(0))
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+
+	for i := 0; i < num; i++ {
+		lsm.Merge(getKey(i), []byte("1"))
+	}
+	lsm.Merge(getKey(num), []byte("10"))
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+
+	snap := lsm.NewSnapshot()
+	for i := 0; i < num; i++ {
+		lsm.Merge(getKey(i), []byte("0"))
+	}
+	lsm.Merge(getKey(num), []byte("1"))
+
+	expected := func(i int) []byte {
+		if i == 0 {
+			return []byte("1")
+		}
+		if i == num {
+			return []byte("11")
+		}
+		return []byte(strconv.Itoa(i + 1))
+	}
+	checkData := func() {
+		for i := 0; i <= num; i++ {
+			value, err := lsm.Get(getKey(i))
+			assert.Nil(err)
+			assert.Equal(expected(i), value)
+		}
+		value, err := snap.Get(getKey(num))
+		assert.Nil(err)
+		assert.Equal([]byte("10"), value)
+
+		keys := make([][]byte, num+1)
+		for i := range keys {
+			keys[i] = getKey(i)
+		}
+		values, errs := lsm.MultiGet(keys)
+		for i := range keys {
+			assert.Nil(errs[i])
+			assert.Equal(expected(i), values[i])
+		}
+
+		it := lsm.NewIterator(nil)
+		i := 0
+		for it.First(); it.Valid(); it.Next() {
+			assert.Equal(getKey(i), it.Key())
+			assert.Equal(expected(i), it.Value())
+			i++
+		}
+		assert.Equal(num+1, i)
+		for it.Last(); it.Valid(); it.Prev() {
+			i--
+			assert.Equal(getKey(i), it.Key())
+			assert.Equal(expected(i), it.Value())
+		}
+		assert.Equal(0, i)
+
+		// switch direction.
+		it.Seek(getKey(10))
+		it.Next()
+		it.Prev()
+		assert.Equal(getKey(10), it.Key())
+		assert.Equal(expected(10), it.Value())
+		it.Next()
+		assert.Equal(getKey(11), it.Key())
+		assert.Equal(expected(11), it.Value())
+		assert.Nil(it.Close())
+	}
+	checkData()
+
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	checkData()
+
+	lsm.MajorCompact()
+	checkData()
+
+	// operands are collapsed by compaction.
+	snap.Release()
+	lsm.Put(getKey(-1), nil)
+	lsm.Put(getKey(num+1), nil)
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+
+	lsm.MergeOperator = nil
+	for i := 0; i <= num; i++ {
+		value, err := lsm.Get(getKey(i))
+		assert.Nil(err)
+		assert.Equal(expected(i), value)
+	}
+
+	// merge operator is required.
+	assert.ErrorIs(lsm.Merge(getKey(0), []byte("1")), ErrNoMergeOperator)
+}
+
+func TestMergeDeleted(t *testing.T) {
+	assert := assert.New(t)
+	opt := testOption()
+	opt.MergeOperator = addOperator{}
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	// the operand shadowed by tombstone does not bring back the older value.
+	assert.Nil(lsm.Put(getKey(0), []byte("5")))
+	assert.Nil(lsm.Merge(getKey(0), []byte("1")))
+	assert.Nil(lsm.Delete(getKey(0)))
+
+	// merged with nothing after tombstone.
+	assert.Nil(lsm.Put(getKey(1), []byte("5")))
+	assert.Nil(lsm.Delete(getKey(1)))
+	assert.Nil(lsm.Merge(getKey(1), []byte("1")))
+
+	check := func() {
+		_, err := lsm.Get(getKey(0))
+		assert.ErrorIs(err, ErrKeyNotFound)
+		value, err := lsm.Get(getKey(1))
+		assert.Nil(err)
+		assert.Equal([]byte("1"), value)
+	}
+	check()
+	assert.Nil(lsm.Flush(true))
+	check()
+	assert.Nil(lsm.MajorCompact())
+	check()
+}
+
+// appendOperator appends operands to the value.
+type appendOperator struct{}
+
+func (appendOperator) Merge(_, existing []byte, operands [][]byte) []byte {
+	value := slices.Clone(existing)
+	for _, op := range operands {
+		value = append(value, op...)
+	}
+	return value
+}
+
+func TestMergeTooLarge(t *testing.T) {
+	assert := assert.New(t)
+	opt := testOption()
+	opt.MergeOperator = appendOperator{}
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	// the merged value is larger than memdb, so the operands are not collapsed.
+	const num = 70
+	var expected []byte
+	assert.Nil(lsm.Put(getKey(0), []byte("0")))
+	expected = append(expected, '0')
+	for i := 0; i < num; i++ {
+		operand := bytes.Repeat([]byte{byte('a' + i%26)}, option.KB)
+		assert.Nil(lsm.Merge(getKey(0), operand))
+		expected = append(expected, operand...)
+	}
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+
+	value, err := lsm.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal(expected, value)
+
+	// collapsed after operands are deleted.
+	assert.Nil(lsm.Delete(getKey(0)))
+	assert.Nil(lsm.Merge(getKey(0), []byte("1")))
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.MajorCompact())
+	value, err = lsm.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal([]byte("1"), value)
+	assert.Equal(uint64(1), lsm.ApproximateCount(nil, nil))
+}
+
+func TestMergeDumping(t *testing.T) {
+	assert := assert.New(t)
+	opt := testOption()
+	opt.MergeOperator = addOperator{}
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	assert.Nil(lsm.Put(getKey(0), []byte("10")))
+	assert.Nil(lsm.Merge(getKey(0), []byte("1")))
+
+	// the memdb is in level0 and not removed yet, as it is being dumped.
+	assert.Nil(lsm.rotate())
+	assert.Nil(lsm.defaultCF.index.AddLevel0Table(lsm.defaultCF.dbList[0]))
+
+	value, err := lsm.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal([]byte("11"), value)
+	values, errs := lsm.MultiGet([][]byte{getKey(0)})
+	assert.Nil(errs[0])
+	assert.Equal([]byte("11"), values[0])
+}
@@ -14,8 +14,82 @@ type Option struct {
 	MemDBSize     uint32
 	DataBlockSize uint32
 
+	// memdbs are dumped as soon as they are full, and level0 is compacted when writes are stalled,
+	// the intervals are the fallback of them, which only run while there are immutable memdbs
+	// or level0 tables.
 	MinorCompactInterval time.Duration
 	MajorCompactInterval time.Duration
+
+	// DisableAutoCompaction stops the background compactions, they are only done
+	// by Flush, MinorCompact and MajorCompact. writes are not stalled then.
+	DisableAutoCompaction bool
+
+	// writes are stopped when any column family has MaxImmutableMemDBs immutable memdbs
+	// or Level0StopTables level0 tables, and delayed from Level0SlowdownTables level0 tables,
+	// until compaction catches up. 0 means no limit.
+	MaxImmutableMemDBs   int
+	Level0SlowdownTables int
+	Level0StopTables     int
+
+	// AutoResume resumes from the transient background error like ENOSPC
+	// before the next background compaction.
+	AutoResume bool
+
+	// MinBlobSize is the min size of value stored in blob file instead of sstable when
+	// the sstable is written, 0 means disabled. values are put into memdb before, so they
+	// are still limited to 64KB-1 bytes, the larger ones return ErrTooLarge.
+	MinBlobSize uint32
+
+	// BlobGCRatio is the ratio of live records below which the blob file is collected,
+	// the live values in it are rewritten by compaction.
+	BlobGCRatio float64
+
+	// Compression is the compression of the blocks of tables written,
+	// the tables written with the other compression are still readable.
+	Compression Compression
+
+	// MergeOperator is required by Merge.
+	MergeOperator MergeOperator
+
+	// CompactionStyle is how level0 tables are compacted, LevelCompaction by default.
+	CompactionStyle CompactionStyle
+
+	// FIFOMaxTableSize is the max total size of tables with FIFOCompaction,
+	// the oldest tables are dropped when it is exceeded, 0 means no limit.
+	FIFOMaxTableSize uint64
+
+	// ColumnFamilies is the options of the column families created before, by name,
+	// the column family not in it is opened with the option of LSM.
+	// the options of table, memdb, blob, merge and compaction style are per column family,
+	// while the intervals, the write stall limits and AutoResume are of LSM.
+	ColumnFamilies map[string]*Option
+}
+
+// Compression is the compression of table blocks.
+type Compression uint32
+
+const (
+	ZstdCompression Compression = iota
+	NoCompression
+)
+
+// CompactionStyle is the compaction style of column family.
+type CompactionStyle uint32
+
+const (
+	// LevelCompaction merges level0 tables into the sorted level1.
+	LevelCompaction CompactionStyle = iota
+	// FIFOCompaction keeps tables in level0 without merging, and drops the oldest ones
+	// when their total size exceeds FIFOMaxTableSize, which suits the data like logs.
+	// the write stall limits of level0 are not applied to it.
+	FIFOCompaction
+)
+
+// MergeOperator merges the operands of Merge into the existing value of key.
+type MergeOperator interface {
+	// Merge return the new value, existing is nil if key does not exist,
+	// and operands are ordered from oldest to newest.
+	Merge(key, existing []byte, operands [][]byte) []byte
 }
 
 // DefaultOption
@@ -25,4 +99,8 @@ var DefaultOption = &Option{
 	DataBlockSize:        4 * KB,
 	MinorCompactInterval: time.Second,
 	MajorCompactInterval: 5 * time.Second,
+	MaxImmutableMemDBs:   4,
+	Level0SlowdownTables: 8,
+	Level0StopTables:     12,
+	BlobGCRatio:          0.5,
 }
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.26.0
+// 	protoc-gen-go v1.31.0
 // 	protoc        v3.17.3
 // source: lsm.proto
 
@@ -25,9 +25,9 @@ type DataBlock struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Keys   [][]byte `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
-	Values [][]byte `protobuf:"bytes,2,rep,name=values,proto3" json:"values,omitempty"`
-	Types  []byte   `protobuf:"bytes,3,opt,name=types,proto3" json:"types,omitempty"`
+	Keys    [][]byte `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"` // internal keys.
+	Values  [][]byte `protobuf:"bytes,2,rep,name=values,proto3" json:"values,omitempty"`
+	Expires []int64  `protobuf:"varint,4,rep,packed,name=expires,proto3" json:"expires,omitempty"` // expiry unix nano timestamps, 0 means never, empty if no entry expires.
 }
 
 func (x *DataBlock) Reset() {
@@ -76,9 +76,9 @@ func (x *DataBlock) GetValues() [][]byte {
 	return nil
 }
 
-func (x *DataBlock) GetTypes() []byte {
+func (x *DataBlock) GetExpires() []int64 {
 	if x != nil {
-		return x.Types
+		return x.Expires
 	}
 	return nil
 }
@@ -92,7 +92,6 @@ type IndexBlockEntry struct {
 	Offset uint32 `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
 	Size   uint32 `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`     // binary size of the data block.
 	Length uint32 `protobuf:"varint,4,opt,name=length,proto3" json:"length,omitempty"` // data legnth of the data block.
-	Cached bool   `protobuf:"varint,5,opt,name=cached,proto3" json:"cached,omitempty"`
 }
 
 func (x *IndexBlockEntry) Reset() {
@@ -155,21 +154,19 @@ func (x *IndexBlockEntry) GetLength() uint32 {
 	return 0
 }
 
-func (x *IndexBlockEntry) GetCached() bool {
-	if x != nil {
-		return x.Cached
-	}
-	return false
-}
-
 type IndexBlock struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	MinKey  []byte             `protobuf:"bytes,1,opt,name=minKey,proto3" json:"minKey,omitempty"`
-	MaxKey  []byte             `protobuf:"bytes,2,opt,name=maxKey,proto3" json:"maxKey,omitempty"`
-	Entries []*IndexBlockEntry `protobuf:"bytes,3,rep,name=entries,proto3" json:"entries,omitempty"`
+	MinKey         []byte             `protobuf:"bytes,1,opt,name=minKey,proto3" json:"minKey,omitempty"`
+	MaxKey         []byte             `protobuf:"bytes,2,opt,name=maxKey,proto3" json:"maxKey,omitempty"`
+	Entries        []*IndexBlockEntry `protobuf:"bytes,3,rep,name=entries,proto3" json:"entries,omitempty"`
+	MaxSeq         uint64             `protobuf:"varint,4,opt,name=maxSeq,proto3" json:"maxSeq,omitempty"` // max sequence number of the table.
+	RangeDelOffset uint32             `protobuf:"varint,5,opt,name=rangeDelOffset,proto3" json:"rangeDelOffset,omitempty"`
+	RangeDelSize   uint32             `protobuf:"varint,6,opt,name=rangeDelSize,proto3" json:"rangeDelSize,omitempty"`                                                                                  // binary size of the range tombstone block, 0 if there is none.
+	BlobRefs       map[uint64]uint64  `protobuf:"bytes,7,rep,name=blobRefs,proto3" json:"blobRefs,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"` // size of records referenced in each blob file by KindBlob entries.
+	Compression    uint32             `protobuf:"varint,8,opt,name=compression,proto3" json:"compression,omitempty"`                                                                                    // compression of the data and range tombstone blocks, 0 is zstd.
 }
 
 func (x *IndexBlock) Reset() {
@@ -225,30 +222,199 @@ func (x *IndexBlock) GetEntries() []*IndexBlockEntry {
 	return nil
 }
 
+func (x *IndexBlock) GetMaxSeq() uint64 {
+	if x != nil {
+		return x.MaxSeq
+	}
+	return 0
+}
+
+func (x *IndexBlock) GetRangeDelOffset() uint32 {
+	if x != nil {
+		return x.RangeDelOffset
+	}
+	return 0
+}
+
+func (x *IndexBlock) GetRangeDelSize() uint32 {
+	if x != nil {
+		return x.RangeDelSize
+	}
+	return 0
+}
+
+func (x *IndexBlock) GetBlobRefs() map[uint64]uint64 {
+	if x != nil {
+		return x.BlobRefs
+	}
+	return nil
+}
+
+func (x *IndexBlock) GetCompression() uint32 {
+	if x != nil {
+		return x.Compression
+	}
+	return 0
+}
+
+type RangeTombstone struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Start []byte `protobuf:"bytes,1,opt,name=start,proto3" json:"start,omitempty"`
+	End   []byte `protobuf:"bytes,2,opt,name=end,proto3" json:"end,omitempty"`
+	Seq   uint64 `protobuf:"varint,3,opt,name=seq,proto3" json:"seq,omitempty"`
+}
+
+func (x *RangeTombstone) Reset() {
+	*x = RangeTombstone{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_lsm_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RangeTombstone) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RangeTombstone) ProtoMessage() {}
+
+func (x *RangeTombstone) ProtoReflect() protoreflect.Message {
+	mi := &file_lsm_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RangeTombstone.ProtoReflect.Descriptor instead.
+func (*RangeTombstone) Descriptor() ([]byte, []int) {
+	return file_lsm_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *RangeTombstone) GetStart() []byte {
+	if x != nil {
+		return x.Start
+	}
+	return nil
+}
+
+func (x *RangeTombstone) GetEnd() []byte {
+	if x != nil {
+		return x.End
+	}
+	return nil
+}
+
+func (x *RangeTombstone) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+type RangeDelBlock struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Tombstones []*RangeTombstone `protobuf:"bytes,1,rep,name=tombstones,proto3" json:"tombstones,omitempty"`
+}
+
+func (x *RangeDelBlock) Reset() {
+	*x = RangeDelBlock{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_lsm_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RangeDelBlock) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RangeDelBlock) ProtoMessage() {}
+
+func (x *RangeDelBlock) ProtoReflect() protoreflect.Message {
+	mi := &file_lsm_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RangeDelBlock.ProtoReflect.Descriptor instead.
+func (*RangeDelBlock) Descriptor() ([]byte, []int) {
+	return file_lsm_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *RangeDelBlock) GetTombstones() []*RangeTombstone {
+	if x != nil {
+		return x.Tombstones
+	}
+	return nil
+}
+
 var File_lsm_proto protoreflect.FileDescriptor
 
 var file_lsm_proto_rawDesc = []byte{
-	0x0a, 0x09, 0x6c, 0x73, 0x6d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x4d, 0x0a, 0x09, 0x44,
+	0x0a, 0x09, 0x6c, 0x73, 0x6d, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x57, 0x0a, 0x09, 0x44,
 	0x61, 0x74, 0x61, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x6b, 0x65, 0x79, 0x73,
 	0x18, 0x01, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x04, 0x6b, 0x65, 0x79, 0x73, 0x12, 0x16, 0x0a, 0x06,
 	0x76, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0c, 0x52, 0x06, 0x76, 0x61,
-	0x6c, 0x75, 0x65, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x79, 0x70, 0x65, 0x73, 0x18, 0x03, 0x20,
-	0x01, 0x28, 0x0c, 0x52, 0x05, 0x74, 0x79, 0x70, 0x65, 0x73, 0x22, 0x85, 0x01, 0x0a, 0x0f, 0x49,
-	0x6e, 0x64, 0x65, 0x78, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x16,
-	0x0a, 0x06, 0x6d, 0x61, 0x78, 0x4b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06,
-	0x6d, 0x61, 0x78, 0x4b, 0x65, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x12,
-	0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x69,
-	0x7a, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x04, 0x20, 0x01,
-	0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x61,
-	0x63, 0x68, 0x65, 0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x63, 0x61, 0x63, 0x68,
-	0x65, 0x64, 0x22, 0x68, 0x0a, 0x0a, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x42, 0x6c, 0x6f, 0x63, 0x6b,
-	0x12, 0x16, 0x0a, 0x06, 0x6d, 0x69, 0x6e, 0x4b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c,
-	0x52, 0x06, 0x6d, 0x69, 0x6e, 0x4b, 0x65, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x61, 0x78, 0x4b,
-	0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x6d, 0x61, 0x78, 0x4b, 0x65, 0x79,
-	0x12, 0x2a, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28,
-	0x0b, 0x32, 0x10, 0x2e, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x45, 0x6e,
-	0x74, 0x72, 0x79, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x42, 0x1e, 0x5a, 0x1c,
+	0x6c, 0x75, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x18,
+	0x04, 0x20, 0x03, 0x28, 0x03, 0x52, 0x07, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x4a, 0x04,
+	0x08, 0x03, 0x10, 0x04, 0x22, 0x73, 0x0a, 0x0f, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x42, 0x6c, 0x6f,
+	0x63, 0x6b, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x61, 0x78, 0x4b, 0x65,
+	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x6d, 0x61, 0x78, 0x4b, 0x65, 0x79, 0x12,
+	0x16, 0x0a, 0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x06, 0x6f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x73, 0x69, 0x7a, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x6c,
+	0x65, 0x6e, 0x67, 0x74, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x6c, 0x65, 0x6e,
+	0x67, 0x74, 0x68, 0x4a, 0x04, 0x08, 0x05, 0x10, 0x06, 0x22, 0xe2, 0x02, 0x0a, 0x0a, 0x49, 0x6e,
+	0x64, 0x65, 0x78, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x69, 0x6e, 0x4b,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x6d, 0x69, 0x6e, 0x4b, 0x65, 0x79,
+	0x12, 0x16, 0x0a, 0x06, 0x6d, 0x61, 0x78, 0x4b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x06, 0x6d, 0x61, 0x78, 0x4b, 0x65, 0x79, 0x12, 0x2a, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72,
+	0x69, 0x65, 0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x49, 0x6e, 0x64, 0x65,
+	0x78, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x65, 0x6e, 0x74,
+	0x72, 0x69, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x61, 0x78, 0x53, 0x65, 0x71, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x6d, 0x61, 0x78, 0x53, 0x65, 0x71, 0x12, 0x26, 0x0a, 0x0e,
+	0x72, 0x61, 0x6e, 0x67, 0x65, 0x44, 0x65, 0x6c, 0x4f, 0x66, 0x66, 0x73, 0x65, 0x74, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x44, 0x65, 0x6c, 0x4f, 0x66,
+	0x66, 0x73, 0x65, 0x74, 0x12, 0x22, 0x0a, 0x0c, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x44, 0x65, 0x6c,
+	0x53, 0x69, 0x7a, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x72, 0x61, 0x6e, 0x67,
+	0x65, 0x44, 0x65, 0x6c, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x35, 0x0a, 0x08, 0x62, 0x6c, 0x6f, 0x62,
+	0x52, 0x65, 0x66, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x49, 0x6e, 0x64,
+	0x65, 0x78, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x2e, 0x42, 0x6c, 0x6f, 0x62, 0x52, 0x65, 0x66, 0x73,
+	0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x62, 0x6c, 0x6f, 0x62, 0x52, 0x65, 0x66, 0x73, 0x12,
+	0x20, 0x0a, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x08,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f,
+	0x6e, 0x1a, 0x3b, 0x0a, 0x0d, 0x42, 0x6c, 0x6f, 0x62, 0x52, 0x65, 0x66, 0x73, 0x45, 0x6e, 0x74,
+	0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x4a,
+	0x0a, 0x0e, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65,
+	0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x65, 0x6e, 0x64, 0x18, 0x02, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x03, 0x65, 0x6e, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x71, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x04, 0x52, 0x03, 0x73, 0x65, 0x71, 0x22, 0x40, 0x0a, 0x0d, 0x52, 0x61,
+	0x6e, 0x67, 0x65, 0x44, 0x65, 0x6c, 0x42, 0x6c, 0x6f, 0x63, 0x6b, 0x12, 0x2f, 0x0a, 0x0a, 0x74,
+	0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32,
+	0x0f, 0x2e, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x54, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65,
+	0x52, 0x0a, 0x74, 0x6f, 0x6d, 0x62, 0x73, 0x74, 0x6f, 0x6e, 0x65, 0x73, 0x42, 0x1e, 0x5a, 0x1c,
 	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x78, 0x67, 0x7a, 0x6c, 0x75,
 	0x63, 0x61, 0x72, 0x69, 0x6f, 0x2f, 0x4c, 0x53, 0x4d, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72,
 	0x6f, 0x74, 0x6f, 0x33,
@@ -266,19 +432,24 @@ func file_lsm_proto_rawDescGZIP() []byte {
 	return file_lsm_proto_rawDescData
 }
 
-var file_lsm_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_lsm_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
 var file_lsm_proto_goTypes = []interface{}{
 	(*DataBlock)(nil),       // 0: DataBlock
 	(*IndexBlockEntry)(nil), // 1: IndexBlockEntry
 	(*IndexBlock)(nil),      // 2: IndexBlock
+	(*RangeTombstone)(nil),  // 3: RangeTombstone
+	(*RangeDelBlock)(nil),   // 4: RangeDelBlock
+	nil,                     // 5: IndexBlock.BlobRefsEntry
 }
 var file_lsm_proto_depIdxs = []int32{
 	1, // 0: IndexBlock.entries:type_name -> IndexBlockEntry
-	1, // [1:1] is the sub-list for method output_type
-	1, // [1:1] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	5, // 1: IndexBlock.blobRefs:type_name -> IndexBlock.BlobRefsEntry
+	3, // 2: RangeDelBlock.tombstones:type_name -> RangeTombstone
+	3, // [3:3] is the sub-list for method output_type
+	3, // [3:3] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_lsm_proto_init() }
@@ -323,6 +494,30 @@ func file_lsm_proto_init() {
 				return nil
 			}
 		}
+		file_lsm_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RangeTombstone); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_lsm_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RangeDelBlock); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -330,7 +525,7 @@ func file_lsm_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_lsm_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   6,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,142 @@
+// Package rangedel is the range tombstone of LSM-Tree.
+package rangedel
+
+import (
+	"bytes"
+	"cmp"
+	"slices"
+	"sort"
+)
+
+// Tombstone deletes the versions of user keys in [Start, End) whose sequence number is less than Seq.
+type Tombstone struct {
+	Start []byte
+	End   []byte
+	Seq   uint64
+}
+
+// Contains return true if key is in [Start, End).
+func (t Tombstone) Contains(key []byte) bool {
+	return bytes.Compare(t.Start, key) <= 0 && bytes.Compare(key, t.End) < 0
+}
+
+// Clip return the part of t in [start, end), nil start or end means unbounded.
+// false is returned if the part is empty.
+func (t Tombstone) Clip(start, end []byte) (Tombstone, bool) {
+	if start != nil && bytes.Compare(t.Start, start) < 0 {
+		t.Start = start
+	}
+	if end != nil && bytes.Compare(t.End, end) > 0 {
+		t.End = end
+	}
+	return t, bytes.Compare(t.Start, t.End) < 0
+}
+
+// List is a list of tombstones, which may overlap.
+type List []Tombstone
+
+// MaxSeq return the max sequence number of tombstones which contain key and are visible to seq,
+// 0 is returned if there is none.
+func (l List) MaxSeq(key []byte, seq uint64) uint64 {
+	var res uint64
+	for _, t := range l {
+		if t.Seq <= seq && t.Seq > res && t.Contains(key) {
+			res = t.Seq
+		}
+	}
+	return res
+}
+
+// Fragment is a part of tombstones, with the sequence numbers of tombstones over it in descending order.
+type Fragment struct {
+	Start []byte
+	End   []byte
+	Seqs  []uint64
+}
+
+// Fragments is the sorted and not overlapping fragments of tombstones,
+// which is built once for a memdb or table.
+type Fragments []Fragment
+
+// Fragment splits the tombstones of l into fragments, by sweeping the bounds of tombstones.
+func (l List) Fragment() Fragments {
+	var bounds [][]byte
+	for _, t := range l {
+		if bytes.Compare(t.Start, t.End) < 0 {
+			bounds = append(bounds, t.Start, t.End)
+		}
+	}
+	slices.SortFunc(bounds, bytes.Compare)
+	bounds = slices.CompactFunc(bounds, bytes.Equal)
+
+	l = slices.Clone(l)
+	slices.SortFunc(l, func(a, b Tombstone) int {
+		return bytes.Compare(a.Start, b.Start)
+	})
+
+	var frags Fragments
+	var active List
+	for i := 0; i+1 < len(bounds); i++ {
+		start, end := bounds[i], bounds[i+1]
+
+		// the active tombstones contain [start, end), since end is the next bound.
+		for len(l) > 0 && bytes.Compare(l[0].Start, start) <= 0 {
+			if bytes.Compare(l[0].Start, l[0].End) < 0 {
+				active = append(active, l[0])
+			}
+			l = l[1:]
+		}
+		active = slices.DeleteFunc(active, func(t Tombstone) bool {
+			return bytes.Compare(t.End, start) <= 0
+		})
+		if len(active) == 0 {
+			continue
+		}
+
+		seqs := make([]uint64, 0, len(active))
+		for _, t := range active {
+			seqs = append(seqs, t.Seq)
+		}
+		slices.SortFunc(seqs, func(a, b uint64) int {
+			return cmp.Compare(b, a)
+		})
+		frags = append(frags, Fragment{Start: start, End: end, Seqs: slices.Compact(seqs)})
+	}
+	return frags
+}
+
+// MaxSeq return the max sequence number of tombstones which contain key and are visible to seq,
+// 0 is returned if there is none.
+func (f Fragments) MaxSeq(key []byte, seq uint64) uint64 {
+	if len(f) == 0 || bytes.Compare(key, f[0].Start) < 0 || bytes.Compare(key, f[len(f)-1].End) >= 0 {
+		return 0
+	}
+	// find the last fragment whose start <= key.
+	i, found := slices.BinarySearchFunc(f, key, func(frag Fragment, key []byte) int {
+		return bytes.Compare(frag.Start, key)
+	})
+	if !found {
+		i--
+	}
+	if bytes.Compare(key, f[i].End) >= 0 {
+		return 0
+	}
+	seqs := f[i].Seqs
+	if j := sort.Search(len(seqs), func(j int) bool { return seqs[j] <= seq }); j < len(seqs) {
+		return seqs[j]
+	}
+	return 0
+}
+
+// Set is the fragments of several memdbs or tables.
+type Set []Fragments
+
+// MaxSeq return the max sequence number of tombstones in s which contain key and are visible to seq,
+// 0 is returned if there is none.
+func (s Set) MaxSeq(key []byte, seq uint64) uint64 {
+	var res uint64
+	for _, f := range s {
+		res = max(res, f.MaxSeq(key, seq))
+	}
+	return res
+}
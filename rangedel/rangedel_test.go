@@ -0,0 +1,65 @@
+package rangedel
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTombstone(t *testing.T) {
+	assert := assert.New(t)
+	tomb := Tombstone{Start: []byte("b"), End: []byte("d"), Seq: 10}
+
+	assert.False(tomb.Contains([]byte("a")))
+	assert.True(tomb.Contains([]byte("b")))
+	assert.True(tomb.Contains([]byte("c\x00")))
+	assert.False(tomb.Contains([]byte("d")))
+
+	clip, ok := tomb.Clip([]byte("c"), nil)
+	assert.True(ok)
+	assert.Equal(Tombstone{Start: []byte("c"), End: []byte("d"), Seq: 10}, clip)
+	clip, ok = tomb.Clip(nil, []byte("c"))
+	assert.True(ok)
+	assert.Equal(Tombstone{Start: []byte("b"), End: []byte("c"), Seq: 10}, clip)
+	_, ok = tomb.Clip([]byte("d"), []byte("e"))
+	assert.False(ok)
+}
+
+func TestFragment(t *testing.T) {
+	assert := assert.New(t)
+	list := List{
+		{Start: []byte("a"), End: []byte("e"), Seq: 1},
+		{Start: []byte("c"), End: []byte("g"), Seq: 3},
+		{Start: []byte("b"), End: []byte("d"), Seq: 2},
+		{Start: []byte("x"), End: []byte("z"), Seq: 9},
+		{Start: []byte("m"), End: []byte("m"), Seq: 5},
+	}
+
+	cases := []struct {
+		key  string
+		seq  uint64
+		want uint64
+	}{
+		{"0", 9, 0},
+		{"a", 9, 1},
+		{"b", 9, 2},
+		{"c", 9, 3},
+		{"d", 9, 3},
+		{"f", 9, 3},
+		{"g", 9, 0},
+		{"m", 9, 0},
+		{"y", 9, 9},
+		{"y", 8, 0},
+		{"c", 2, 2},
+		{"c", 1, 1},
+		{"c", 0, 0},
+	}
+	frags := list.Fragment()
+	for _, c := range cases {
+		assert.Equal(c.want, frags.MaxSeq([]byte(c.key), c.seq), c)
+		assert.Equal(c.want, list.MaxSeq([]byte(c.key), c.seq), c)
+		assert.Equal(c.want, Set{frags[:2], frags[2:]}.MaxSeq([]byte(c.key), c.seq), c)
+	}
+	assert.Equal(Fragment{Start: []byte("c"), End: []byte("d"), Seqs: []uint64{3, 2, 1}}, frags[2])
+	assert.Empty(List{}.Fragment())
+}
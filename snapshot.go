@@ -0,0 +1,58 @@
+package lsm
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Snapshot is a read-only view of LSM at the moment it is created.
+// It must be released after use, so that compaction can discard the old versions.
+type Snapshot struct {
+	lsm  *LSM
+	seq  uint64
+	elem *list.Element
+	once sync.Once
+}
+
+// NewSnapshot
+func (lsm *LSM) NewSnapshot() *Snapshot {
+	lsm.snapMu.Lock()
+	defer lsm.snapMu.Unlock()
+
+	// snapshots are ordered by sequence number.
+	snap := &Snapshot{lsm: lsm, seq: lsm.seq.Load()}
+	snap.elem = lsm.snapshots.PushBack(snap)
+
+	return snap
+}
+
+// Get find value by key as of the snapshot.
+func (s *Snapshot) Get(key []byte) ([]byte, error) {
+	return s.lsm.defaultCF.get(key, s.seq)
+}
+
+// GetCF find value by key in column family as of the snapshot.
+func (s *Snapshot) GetCF(cf *ColumnFamily, key []byte) ([]byte, error) {
+	return cf.get(key, s.seq)
+}
+
+// Release
+func (s *Snapshot) Release() {
+	s.once.Do(func() {
+		s.lsm.snapMu.Lock()
+		s.lsm.snapshots.Remove(s.elem)
+		s.lsm.snapMu.Unlock()
+	})
+}
+
+// smallestSeq return the sequence number of the oldest snapshot,
+// versions visible to it and newer ones must be retained by compaction.
+func (lsm *LSM) smallestSeq() uint64 {
+	lsm.snapMu.Lock()
+	defer lsm.snapMu.Unlock()
+
+	if front := lsm.snapshots.Front(); front != nil {
+		return front.Value.(*Snapshot).seq
+	}
+	return lsm.seq.Load()
+}
@@ -0,0 +1,154 @@
+package lsm
+
+import (
+	"context"
+	"time"
+
+	"github.com/xgzlucario/LSM/option"
+)
+
+const (
+	// slowdownDelay is the delay of each write when level0 reaches option.Level0SlowdownTables.
+	slowdownDelay = time.Millisecond
+)
+
+type stallState int
+
+const (
+	stallNone stallState = iota
+	stallSlowdown
+	stallMemDB
+	stallLevel0
+)
+
+// StallStats is the statistics of writes delayed or stopped by flush and compaction.
+type StallStats struct {
+	// Slowdowns is the number of writes delayed.
+	Slowdowns uint64
+	// Stops is the number of writes stopped until compaction catches up.
+	Stops uint64
+	// Duration is the total time of writes delayed and stopped.
+	Duration time.Duration
+}
+
+// StallStats
+func (lsm *LSM) StallStats() StallStats {
+	return StallStats{
+		Slowdowns: lsm.slowdowns.Load(),
+		Stops:     lsm.stops.Load(),
+		Duration:  time.Duration(lsm.stallNanos.Load()),
+	}
+}
+
+// stallState return whether writes should be delayed or stopped.
+// writes are never stalled without auto compaction, since nothing catches up in background.
+func (lsm *LSM) stallState() stallState {
+	if lsm.DisableAutoCompaction {
+		return stallNone
+	}
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	state := stallNone
+	for _, cf := range lsm.cfs {
+		if lsm.MaxImmutableMemDBs > 0 && len(cf.dbList) >= lsm.MaxImmutableMemDBs {
+			return stallMemDB
+		}
+		// level0 of FIFOCompaction is never merged, which is limited by size only.
+		if cf.opt.CompactionStyle == option.FIFOCompaction {
+			continue
+		}
+		n := cf.index.NumLevel0Tables()
+		if lsm.Level0StopTables > 0 && n >= lsm.Level0StopTables {
+			return stallLevel0
+		}
+		if lsm.Level0SlowdownTables > 0 && n >= lsm.Level0SlowdownTables {
+			state = stallSlowdown
+		}
+	}
+	return state
+}
+
+// stall delays or blocks the write until flush and compaction catch up, or ctx is done.
+// it must be called without writeMu held, so that the waiting writes can be canceled.
+func (lsm *LSM) stall(ctx context.Context) error {
+	var start time.Time
+	defer func() {
+		if !start.IsZero() {
+			lsm.stallNanos.Add(int64(time.Since(start)))
+		}
+	}()
+
+	for {
+		if lsm.closed.Load() {
+			return ErrClosed
+		}
+		// compaction is stopped by the background error.
+		if err := lsm.BackgroundError(); err != nil {
+			return err
+		}
+		// get the channel before checking, so that the wakeup is not missed.
+		stallC := lsm.stallC()
+
+		switch lsm.stallState() {
+		case stallNone:
+			return nil
+
+		case stallSlowdown:
+			// the write is not delayed again after stopped.
+			if !start.IsZero() {
+				return nil
+			}
+			lsm.slowdowns.Add(1)
+			start = time.Now()
+			notify(lsm.majorC)
+
+			select {
+			case <-time.After(slowdownDelay):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+
+		case stallMemDB:
+			notify(lsm.minorC)
+		case stallLevel0:
+			notify(lsm.majorC)
+		}
+
+		if start.IsZero() {
+			lsm.stops.Add(1)
+			start = time.Now()
+		}
+		select {
+		case <-stallC:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-lsm.ctx.Done():
+			return ErrClosed
+		}
+	}
+}
+
+// stallC return the channel which is closed when flush or compaction is done.
+func (lsm *LSM) stallC() <-chan struct{} {
+	lsm.stallMu.Lock()
+	defer lsm.stallMu.Unlock()
+	return lsm.stallCh
+}
+
+// wakeStalled wakes the stalled writes up to check again.
+func (lsm *LSM) wakeStalled() {
+	lsm.stallMu.Lock()
+	close(lsm.stallCh)
+	lsm.stallCh = make(chan struct{})
+	lsm.stallMu.Unlock()
+}
+
+// notify triggers the background work of c without blocking.
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,125 @@
+package lsm
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/option"
+)
+
+func TestWriteStall(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := testOption()
+	opt.DisableAutoCompaction = false
+	opt.MaxImmutableMemDBs = 2
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	// the stopped writes trigger flush in background, which is blocked until they stop.
+	const num = 10000
+	lsm.compactC <- struct{}{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < num; i++ {
+			assert.Nil(lsm.Put(getKey(i), getValue(i, 0)))
+		}
+	}()
+	assert.Eventually(func() bool {
+		return lsm.StallStats().Stops > 0
+	}, time.Second, time.Millisecond)
+	<-lsm.compactC
+	<-done
+
+	lsm.mu.RLock()
+	assert.LessOrEqual(len(lsm.defaultCF.dbList), 2)
+	lsm.mu.RUnlock()
+	checkGet(lsm, 0, num, 0, assert)
+}
+
+func TestWriteStallContext(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := testOption()
+	opt.DisableAutoCompaction = false
+	opt.MaxImmutableMemDBs = 1
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	assert.Nil(lsm.Put(getKey(0), getValue(0, 0)))
+
+	// block the compactions.
+	lsm.compactC <- struct{}{}
+	assert.Nil(lsm.Flush(false))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(lsm.PutContext(ctx, getKey(1), getValue(1, 0)), context.DeadlineExceeded)
+	stats := lsm.StallStats()
+	assert.Equal(uint64(1), stats.Stops)
+	assert.GreaterOrEqual(stats.Duration, 10*time.Millisecond)
+
+	// the stopped write continues after flush.
+	<-lsm.compactC
+	assert.Nil(lsm.Put(getKey(1), getValue(1, 0)))
+	assert.Equal(0, len(lsm.defaultCF.dbList))
+	checkGet(lsm, 0, 2, 0, assert)
+
+	// stopped by level0 tables until compaction.
+	lsm.MaxImmutableMemDBs = 0
+	lsm.Level0SlowdownTables = 1
+	lsm.Level0StopTables = 2
+	assert.Nil(lsm.Flush(true))
+	assert.Equal(2, lsm.defaultCF.index.NumLevel0Tables())
+
+	lsm.compactC <- struct{}{}
+	stops := lsm.StallStats().Stops
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(lsm.PutContext(ctx, getKey(2), getValue(2, 0)), context.DeadlineExceeded)
+	assert.Equal(stops+1, lsm.StallStats().Stops)
+	<-lsm.compactC
+	assert.Nil(lsm.Put(getKey(2), getValue(2, 0)))
+	assert.Equal(0, lsm.defaultCF.index.NumLevel0Tables())
+
+	// delayed by level0 tables.
+	assert.Nil(lsm.Flush(true))
+	assert.Nil(lsm.Put(getKey(3), getValue(3, 0)))
+	assert.Equal(uint64(1), lsm.StallStats().Slowdowns)
+	checkGet(lsm, 0, 4, 0, assert)
+}
+
+func TestWriteStallDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	opt := testOption()
+	opt.MaxImmutableMemDBs = option.DefaultOption.MaxImmutableMemDBs
+	opt.Level0SlowdownTables = 1
+	opt.Level0StopTables = 2
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	// no background compaction catches up, so writes past the limits are not stopped.
+	const num = 20000
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for i := 0; i < num; i++ {
+		assert.Nil(lsm.PutContext(ctx, getKey(i), getValue(i, 0)))
+		if i == num/2 {
+			assert.Nil(lsm.Flush(true))
+			assert.Nil(lsm.Flush(true))
+		}
+	}
+	lsm.mu.RLock()
+	assert.Greater(len(lsm.defaultCF.dbList), opt.MaxImmutableMemDBs)
+	lsm.mu.RUnlock()
+	assert.GreaterOrEqual(lsm.defaultCF.index.NumLevel0Tables(), opt.Level0StopTables)
+	assert.Equal(StallStats{}, lsm.StallStats())
+	checkGet(lsm, 0, num, 0, assert)
+}
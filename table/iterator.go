@@ -0,0 +1,145 @@
+package table
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/pb"
+)
+
+// Iterator iterates a table block by block, data blocks are loaded on demand.
+// data blocks entirely outside [lower, upper) are skipped.
+type Iterator struct {
+	t     *Table
+	lower ikey.Key
+	upper ikey.Key
+	index int
+	block *pb.DataBlock
+	pos   int
+	err   error
+}
+
+// NewIterator return an iterator of table, the table is referenced until the iterator is closed.
+// lower and upper are the bounds of internal key, nil means unbounded.
+func (s *Table) NewIterator(lower, upper ikey.Key) *Iterator {
+	s.AddRef()
+	return &Iterator{t: s, lower: lower, upper: upper}
+}
+
+// Overlaps return true if the table may contain keys in [lower, upper).
+func (s *Table) Overlaps(lower, upper ikey.Key) bool {
+	return (lower == nil || bytes.Compare(s.GetMaxKey(), lower) >= 0) &&
+		(upper == nil || bytes.Compare(s.GetMinKey(), upper) < 0)
+}
+
+// First
+func (it *Iterator) First() {
+	if it.lower != nil {
+		it.Seek(it.lower)
+		return
+	}
+	if it.loadBlock(0) {
+		it.pos = 0
+	}
+}
+
+// Last
+func (it *Iterator) Last() {
+	i := len(it.t.blocks) - 1
+	if it.upper != nil {
+		i = min(i, it.t.findBlock(it.upper))
+	}
+	if it.loadBlock(i) {
+		it.pos = len(it.block.Keys) - 1
+	}
+}
+
+// Seek
+func (it *Iterator) Seek(key ikey.Key) {
+	if it.lower != nil && bytes.Compare(key, it.lower) < 0 {
+		key = it.lower
+	}
+	if it.loadBlock(it.t.findBlock(key)) {
+		it.pos, _ = slices.BinarySearchFunc(it.block.Keys, []byte(key), bytes.Compare)
+	}
+}
+
+// Next
+func (it *Iterator) Next() {
+	it.pos++
+	if it.pos >= len(it.block.Keys) && it.loadBlock(it.index+1) {
+		it.pos = 0
+	}
+}
+
+// Prev
+func (it *Iterator) Prev() {
+	it.pos--
+	if it.pos < 0 && it.loadBlock(it.index-1) {
+		it.pos = len(it.block.Keys) - 1
+	}
+}
+
+// Valid
+func (it *Iterator) Valid() bool {
+	return it.block != nil && it.pos >= 0 && it.pos < len(it.block.Keys)
+}
+
+// Key
+func (it *Iterator) Key() ikey.Key {
+	return it.block.Keys[it.pos]
+}
+
+// Value
+func (it *Iterator) Value() []byte {
+	return it.block.Values[it.pos]
+}
+
+// Expire return the expiry unix nano timestamp of entry, 0 means never.
+func (it *Iterator) Expire() int64 {
+	return expireOf(it.block, it.pos)
+}
+
+// Error
+func (it *Iterator) Error() error {
+	return it.err
+}
+
+// Close
+func (it *Iterator) Close() error {
+	if it.t != nil {
+		it.t.DelRef()
+		it.t = nil
+	}
+	return it.err
+}
+
+// loadBlock positions the iterator at data block i, return false and invalidate the iterator
+// if i is out of range, the block is entirely outside the bounds or an error occurs.
+func (it *Iterator) loadBlock(i int) bool {
+	it.index = i
+	it.block = nil
+	if it.err != nil || i < 0 || i >= len(it.t.blocks) || !it.blockOverlaps(i) {
+		return false
+	}
+	it.block, it.err = it.t.getBlock(i)
+	return it.err == nil
+}
+
+// blockOverlaps return true if data block i may contain keys in [lower, upper).
+func (it *Iterator) blockOverlaps(i int) bool {
+	entries := it.t.indexBlock.Entries
+	if it.lower != nil && bytes.Compare(entries[i].MaxKey, it.lower) < 0 {
+		return false
+	}
+	// keys of block i are greater than the max key of the previous block.
+	if it.upper != nil {
+		prevMax := it.t.GetMinKey()
+		if i > 0 {
+			prevMax = entries[i-1].MaxKey
+		}
+		return bytes.Compare(prevMax, it.upper) < 0
+	}
+	return true
+}
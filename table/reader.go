@@ -11,6 +11,9 @@ import (
 
 const (
 	tableExt = ".sst"
+
+	// TmpExt is the extension of the table being written, which is left by a crash.
+	TmpExt = ".tmp"
 )
 
 var (
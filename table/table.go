@@ -8,13 +8,17 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
+	"slices"
+	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/xgzlucario/LSM/bcmp"
-	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/ikey"
 	"github.com/xgzlucario/LSM/option"
 	"github.com/xgzlucario/LSM/pb"
+	"github.com/xgzlucario/LSM/rangedel"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -43,14 +47,24 @@ type Table struct {
 	// ref is the reference count of the table.
 	ref atomic.Int32
 
-	// MemTable is the container for data in memory.
-	// When lookup a table, the data from the corresponding dataBlock on disk is first
-	// loaded into the memTable, and then find it.
-	m *memdb.DB
+	// onRemove is called after the table is removed by DelRef.
+	onRemove func()
+
+	// guards blocks.
+	mu sync.Mutex
+
+	// blocks is the cache of decoded dataBlocks.
+	// When lookup a table, the corresponding dataBlock on disk is first
+	// loaded into the cache, and then find it.
+	blocks []*pb.DataBlock
 
 	// indexBlock is the index of dataBlocks, loaded when the table is opened.
 	indexBlock pb.IndexBlock
 
+	// rangeDels is the range tombstones and their fragments, loaded when the table is opened.
+	rangeDels rangedel.List
+	frags     rangedel.Fragments
+
 	// footer
 	footer Footer
 }
@@ -67,7 +81,7 @@ type Footer struct {
 // String
 func (t *Table) String() string {
 	return fmt.Sprintf("[table] id:%v, level:%v, min:%s, max:%s\n",
-		t.ID(), t.Level(), t.GetMinKey(), t.GetMaxKey())
+		t.ID(), t.Level(), ikey.Key(t.GetMinKey()), ikey.Key(t.GetMaxKey()))
 }
 
 // ID
@@ -75,6 +89,11 @@ func (s *Table) ID() uint64 {
 	return s.footer.Id
 }
 
+// Path
+func (s *Table) Path() string {
+	return s.fd.Name()
+}
+
 // Level
 func (s *Table) Level() int {
 	return int(s.footer.Level)
@@ -90,9 +109,19 @@ func (s *Table) GetMaxKey() []byte {
 	return s.indexBlock.MaxKey
 }
 
-// GetMemDB
-func (s *Table) GetMemDB() *memdb.DB {
-	return s.m
+// MaxSeq return the max sequence number of the table.
+func (s *Table) MaxSeq() uint64 {
+	return s.indexBlock.MaxSeq
+}
+
+// RangeDels return the range tombstones of the table.
+func (s *Table) RangeDels() rangedel.List {
+	return s.rangeDels
+}
+
+// Fragments return the fragments of the range tombstones of the table.
+func (s *Table) Fragments() rangedel.Fragments {
+	return s.frags
 }
 
 // Close
@@ -110,7 +139,64 @@ func (s *Table) DelRef() {
 	if s.ref.Add(-1) == 0 {
 		os.Remove(s.fd.Name())
 		s.fd.Close()
+		if s.onRemove != nil {
+			s.onRemove()
+		}
+	}
+}
+
+// OnRemove sets fn to be called after the table is removed by DelRef.
+func (s *Table) OnRemove(fn func()) {
+	s.onRemove = fn
+}
+
+// BlobRefs return the size of records referenced in each blob file.
+func (s *Table) BlobRefs() map[uint64]uint64 {
+	return s.indexBlock.BlobRefs
+}
+
+// Approximate return the size and number of entries of the data blocks which overlap
+// user keys [start, end), nil means unbounded. It is estimated by the index block only,
+// and the size of values in blob files is counted in proportion to the data blocks.
+func (s *Table) Approximate(start, end []byte) (size, count uint64) {
+	var total uint64
+	entries := s.indexBlock.Entries
+	for _, e := range entries {
+		total += uint64(e.Size)
+	}
+	for i, e := range entries {
+		// user keys of block i are between the max key of block i-1 and its max key.
+		first := s.GetMinKey()
+		if i > 0 {
+			first = entries[i-1].MaxKey
+		}
+		if start != nil && bytes.Compare(ikey.Key(e.MaxKey).UserKey(), start) < 0 {
+			continue
+		}
+		if end != nil && bytes.Compare(ikey.Key(first).UserKey(), end) >= 0 {
+			break
+		}
+		size += uint64(e.Size)
+		count += uint64(e.Length)
+	}
+
+	var blobs uint64
+	for _, n := range s.indexBlock.BlobRefs {
+		blobs += n
+	}
+	if total > 0 {
+		size += uint64(float64(blobs) * float64(size) / float64(total))
+	}
+	return size, count
+}
+
+// Remove closes and removes the table which is not referenced by any level.
+func (s *Table) Remove() error {
+	err := errors.Join(s.fd.Close(), os.Remove(s.fd.Name()))
+	if s.onRemove != nil {
+		s.onRemove()
 	}
+	return err
 }
 
 // loadIndex load index block.
@@ -137,77 +223,179 @@ func (s *Table) loadIndex() error {
 		return ErrChecksum
 	}
 
-	return proto.Unmarshal(buf, &s.indexBlock)
-}
-
-// FindKey return value by find sstable.
-// cached indicates whether the data hit the cache.
-func (s *Table) FindKey(key []byte) (res []byte, cached bool, err error) {
-	for _, entry := range s.indexBlock.Entries {
-		if bcmp.LessEqual(key, entry.MaxKey) {
-			// load cache.
-			if ok, err := s.loadDataBlock(entry); err != nil {
-				return nil, false, err
-
-			} else {
-				cached = !ok
-			}
-			break
-		}
+	if err := proto.Unmarshal(buf, &s.indexBlock); err != nil {
+		return err
 	}
+	s.blocks = make([]*pb.DataBlock, len(s.indexBlock.Entries))
 
-	// find in memtable.
-	res, ok := s.m.Get(key)
-	if !ok {
-		return nil, false, ErrKeyNotFound
-	}
-	return
+	return s.loadRangeDels()
 }
 
-// loadDataBlock load data block to cache.
-func (s *Table) loadDataBlock(entry *pb.IndexBlockEntry) (bool, error) {
-	if entry.Cached {
-		return false, nil
+// loadRangeDels load range tombstone block.
+func (s *Table) loadRangeDels() error {
+	if s.indexBlock.RangeDelSize == 0 {
+		return nil
 	}
-	// load and decode from disk.
-	src, err := seekRead(s.fd, int64(entry.Offset), uint64(entry.Size), io.SeekStart)
+	src, err := seekRead(s.fd, int64(s.indexBlock.RangeDelOffset), uint64(s.indexBlock.RangeDelSize), io.SeekStart)
 	if err != nil {
-		return false, err
+		return err
 	}
-	dst, err := decompress(src, nil)
+	dst, err := decompress(src, nil, option.Compression(s.indexBlock.Compression))
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	var dataBlock pb.DataBlock
-	if err = proto.Unmarshal(dst, &dataBlock); err != nil {
-		return false, err
+	var block pb.RangeDelBlock
+	if err = proto.Unmarshal(dst, &block); err != nil {
+		return err
+	}
+	for _, t := range block.Tombstones {
+		s.rangeDels = append(s.rangeDels, rangedel.Tombstone{Start: t.Start, End: t.End, Seq: t.Seq})
 	}
+	s.frags = s.rangeDels.Fragment()
+	return nil
+}
 
-	// put to memtable.
-	if s.m == nil {
-		s.m = memdb.New2(s.opt.MemDBSize)
+// FindKey return the newest value and kind of user key whose sequence number
+// is not greater than seq by find sstable.
+// KindDel is returned if it is deleted by a range tombstone of the table or expired.
+func (s *Table) FindKey(key []byte, seq uint64) ([]byte, ikey.Kind, error) {
+	lookup := ikey.Make(key, seq, ikey.KindSeek)
+	if !s.mayContain(lookup) {
+		return nil, 0, ErrKeyNotFound
 	}
-	for i, k := range dataBlock.Keys {
-		if s.m.Put(k, dataBlock.Values[i], uint16(dataBlock.Types[i])) {
-			panic("bug: memdb is not large enough")
+
+	var value []byte
+	var k ikey.Key
+	var expire int64
+	if i := s.findBlock(lookup); i < len(s.blocks) {
+		block, err := s.getBlock(i)
+		if err != nil {
+			return nil, 0, err
 		}
+		value, k, expire = findInBlock(block, lookup)
 	}
-	entry.Cached = true
 
-	return true, nil
+	value, kind, ok := s.resolve(key, seq, value, k, expire, time.Now().UnixNano())
+	if !ok {
+		return nil, 0, ErrKeyNotFound
+	}
+	return value, kind, nil
 }
 
-// loadAllDataBlock load all data blocks to cache.
-func (s *Table) loadAllDataBlock() error {
-	for _, entry := range s.indexBlock.Entries {
-		if _, err := s.loadDataBlock(entry); err != nil {
-			return err
+// FindKeys is FindKey of user keys, which must be sorted, so that each data block is
+// searched by the keys in it together. found is called with the index of each key found.
+func (s *Table) FindKeys(keys [][]byte, seq uint64, found func(i int, value []byte, kind ikey.Kind)) error {
+	now := time.Now().UnixNano()
+	cur := -1
+	var block *pb.DataBlock
+
+	for i, key := range keys {
+		lookup := ikey.Make(key, seq, ikey.KindSeek)
+		if !s.mayContain(lookup) {
+			continue
+		}
+
+		var value []byte
+		var k ikey.Key
+		var expire int64
+		if j := s.findBlock(lookup); j < len(s.blocks) {
+			if j != cur {
+				var err error
+				if block, err = s.getBlock(j); err != nil {
+					return err
+				}
+				cur = j
+			}
+			value, k, expire = findInBlock(block, lookup)
+		}
+
+		if value, kind, ok := s.resolve(key, seq, value, k, expire, now); ok {
+			found(i, value, kind)
 		}
 	}
 	return nil
 }
 
+// mayContain return false if the user key of lookup is out of the range of table.
+func (s *Table) mayContain(lookup ikey.Key) bool {
+	// the lookup key may be less than minKey with the same user key,
+	// then minKey is the entry to be found.
+	minKey := ikey.Key(s.GetMinKey())
+	return !bcmp.Great(lookup, s.GetMaxKey()) && (!bcmp.Less(lookup, minKey) || lookup.SameUserKey(minKey))
+}
+
+// resolve return the value and kind of user key by the entry found, nil k means no entry,
+// the key may be deleted by a range tombstone of the table or expired.
+func (s *Table) resolve(key []byte, seq uint64, value []byte, k ikey.Key, expire, now int64) ([]byte, ikey.Kind, bool) {
+	delSeq := s.frags.MaxSeq(key, seq)
+	if k != nil && k.Seq() >= delSeq {
+		if expire != 0 && expire <= now {
+			return nil, ikey.KindDel, true
+		}
+		return value, k.Kind(), true
+	}
+	if delSeq > 0 {
+		return nil, ikey.KindDel, true
+	}
+	return nil, 0, false
+}
+
+// findInBlock return the value, key and expiry of the first entry whose key >= lookup
+// with the same user key, nil key is returned if not found.
+func findInBlock(block *pb.DataBlock, lookup ikey.Key) ([]byte, ikey.Key, int64) {
+	j, _ := slices.BinarySearchFunc(block.Keys, []byte(lookup), bytes.Compare)
+	if j == len(block.Keys) || !ikey.Key(block.Keys[j]).SameUserKey(lookup) {
+		return nil, nil, 0
+	}
+	return block.Values[j], block.Keys[j], expireOf(block, j)
+}
+
+// expireOf return the expiry of entry j in block, 0 means never.
+func expireOf(block *pb.DataBlock, j int) int64 {
+	if len(block.Expires) == 0 {
+		return 0
+	}
+	return block.Expires[j]
+}
+
+// findBlock return the index of the first data block whose maxKey >= key.
+func (s *Table) findBlock(key ikey.Key) int {
+	i, _ := slices.BinarySearchFunc(s.indexBlock.Entries, key, func(entry *pb.IndexBlockEntry, key ikey.Key) int {
+		return bytes.Compare(entry.MaxKey, key)
+	})
+	return i
+}
+
+// getBlock return the data block i, and load it from disk if not cached.
+func (s *Table) getBlock(i int) (*pb.DataBlock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if block := s.blocks[i]; block != nil {
+		return block, nil
+	}
+
+	// load and decode from disk.
+	entry := s.indexBlock.Entries[i]
+	src, err := seekRead(s.fd, int64(entry.Offset), uint64(entry.Size), io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := decompress(src, nil, option.Compression(s.indexBlock.Compression))
+	if err != nil {
+		return nil, err
+	}
+
+	block := new(pb.DataBlock)
+	if err = proto.Unmarshal(dst, block); err != nil {
+		return nil, err
+	}
+	s.blocks[i] = block
+
+	return block, nil
+}
+
 // seekRead first seek(offset, whence) and then read(size).
 func seekRead(fs *os.File, offset int64, size uint64, whence int) ([]byte, error) {
 	if _, err := fs.Seek(offset, whence); err != nil {
@@ -221,18 +409,3 @@ func seekRead(fs *os.File, offset int64, size uint64, whence int) ([]byte, error
 
 	return buf, nil
 }
-
-// MergeTables
-func MergeTables(tables ...*Table) *memdb.DB {
-	for _, t := range tables {
-		if err := t.loadAllDataBlock(); err != nil {
-			panic(err)
-		}
-	}
-	db := make([]*memdb.DB, 0, len(tables))
-	for _, t := range tables {
-		db = append(db, t.m)
-	}
-
-	return memdb.Merge(db...)
-}
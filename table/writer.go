@@ -7,44 +7,61 @@ import (
 	"hash/crc32"
 	"os"
 	"path"
+	"path/filepath"
 
+	"github.com/xgzlucario/LSM/bcmp"
+	"github.com/xgzlucario/LSM/blob"
+	"github.com/xgzlucario/LSM/ikey"
 	"github.com/xgzlucario/LSM/memdb"
 	"github.com/xgzlucario/LSM/option"
 	"github.com/xgzlucario/LSM/pb"
+	"github.com/xgzlucario/LSM/rangedel"
 	"google.golang.org/protobuf/proto"
 )
 
 // Writer
 type Writer struct {
+	dir string
 	buf *bytes.Buffer
 	opt *option.Option
 }
 
 // NewWriter
-func NewWriter(opt *option.Option) *Writer {
+func NewWriter(dir string, opt *option.Option) *Writer {
 	return &Writer{
+		dir: dir,
 		opt: opt,
 		buf: bytes.NewBuffer(make([]byte, 0, opt.MemDBSize)),
 	}
 }
 
-// WriteTable
+// WriteTable writes db into a new table, the values not less than option.MinBlobSize
+// are written into a new blob file with the same id, which is written before the table.
 func (w *Writer) WriteTable(level int, id uint64, db *memdb.DB) (*Table, error) {
-	if err := w.encodeTable(level, id, db); err != nil {
+	bw := blob.NewWriter(w.dir, id)
+	if err := w.encodeTable(level, id, db, bw); err != nil {
+		return nil, err
+	}
+	if err := bw.Finish(); err != nil {
 		return nil, err
 	}
 
 	// write to disk.
 	name := fmt.Sprintf("%08d.sst", id)
-	path := path.Join(w.opt.Path, name)
+	path := path.Join(w.dir, name)
 
-	if err := os.WriteFile(path, w.buf.Bytes(), 0644); err != nil {
+	if err := writeFile(path, w.buf.Bytes()); err != nil {
+		// do not leave a partial table.
+		os.Remove(path)
+		bw.Abort()
 		return nil, err
 	}
 
 	// create reader from file.
 	table, err := NewReader(path, w.opt)
 	if err != nil {
+		os.Remove(path)
+		bw.Abort()
 		return nil, err
 	}
 
@@ -52,21 +69,18 @@ func (w *Writer) WriteTable(level int, id uint64, db *memdb.DB) (*Table, error)
 }
 
 // encodeTable encode db to buffer.
-func (w *Writer) encodeTable(level int, id uint64, db *memdb.DB) error {
+func (w *Writer) encodeTable(level int, id uint64, db *memdb.DB, bw *blob.Writer) error {
 	w.buf.Reset()
 	var size, length uint32
 
 	// initial.
 	dataBlock := new(pb.DataBlock)
-	indexBlock := &pb.IndexBlock{
-		MinKey: db.MinKey(),
-		MaxKey: db.MaxKey(),
-	}
+	indexBlock := &pb.IndexBlock{Compression: uint32(w.opt.Compression)}
 
 	// encode data block function.
 	encodeDataBlock := func() {
 		src, _ := proto.Marshal(dataBlock)
-		dst := compress(src)
+		dst := compress(src, w.opt.Compression)
 
 		indexBlock.Entries = append(indexBlock.Entries, &pb.IndexBlockEntry{
 			MaxKey: dataBlock.Keys[len(dataBlock.Keys)-1],
@@ -80,25 +94,73 @@ func (w *Writer) encodeTable(level int, id uint64, db *memdb.DB) error {
 		size, length = 0, 0
 	}
 
-	db.Iter(func(key, value []byte, meta uint16) {
+	it := db.NewIterator()
+	for it.First(); it.Valid(); it.Next() {
+		key, value := it.Key(), it.Value()
+
+		// separate the large value into blob file.
+		if key.Kind() == ikey.KindVal && w.opt.MinBlobSize > 0 && len(value) >= int(w.opt.MinBlobSize) {
+			key, value = ikey.Make(key.UserKey(), key.Seq(), ikey.KindBlob), bw.Add(value).Encode()
+		}
+		if key.Kind() == ikey.KindBlob {
+			p, err := blob.Decode(value)
+			if err != nil {
+				return err
+			}
+			if indexBlock.BlobRefs == nil {
+				indexBlock.BlobRefs = make(map[uint64]uint64)
+			}
+			indexBlock.BlobRefs[p.File] += p.RecordSize()
+		}
+
+		// the kind of key may be changed, so bounds are the keys written.
+		if indexBlock.MinKey == nil {
+			indexBlock.MinKey = key
+		}
+		indexBlock.MaxKey = key
+
 		dataBlock.Keys = append(dataBlock.Keys, key)
 		dataBlock.Values = append(dataBlock.Values, value)
-		dataBlock.Types = append(dataBlock.Types, byte(meta))
+		indexBlock.MaxSeq = max(indexBlock.MaxSeq, key.Seq())
+
+		// expires are parallel to keys once an entry in block expires.
+		if expire := it.Expire(); expire != 0 || len(dataBlock.Expires) > 0 {
+			if len(dataBlock.Expires) == 0 {
+				dataBlock.Expires = make([]int64, len(dataBlock.Keys)-1, cap(dataBlock.Keys))
+			}
+			dataBlock.Expires = append(dataBlock.Expires, expire)
+		}
 
 		length++
-		size += uint32(len(key) + len(value) + 2)
+		size += uint32(len(key) + len(value))
 
 		// when reach the threshold, generate a new data block.
 		if size >= w.opt.DataBlockSize {
 			encodeDataBlock()
 		}
-	})
+	}
 
 	// encode the last data block.
 	if len(dataBlock.Keys) > 0 {
 		encodeDataBlock()
 	}
 
+	// encode range tombstone block.
+	if rangeDels := db.RangeDels(); len(rangeDels) > 0 {
+		block := new(pb.RangeDelBlock)
+		for _, t := range rangeDels {
+			block.Tombstones = append(block.Tombstones, &pb.RangeTombstone{Start: t.Start, End: t.End, Seq: t.Seq})
+			indexBlock.MaxSeq = max(indexBlock.MaxSeq, t.Seq)
+			extendBounds(indexBlock, t)
+		}
+		src, _ := proto.Marshal(block)
+		dst := compress(src, w.opt.Compression)
+
+		indexBlock.RangeDelOffset = uint32(w.buf.Len())
+		indexBlock.RangeDelSize = uint32(len(dst))
+		w.buf.Write(dst)
+	}
+
 	// encode index block.
 	data, err := proto.Marshal(indexBlock)
 	if err != nil {
@@ -115,3 +177,66 @@ func (w *Writer) encodeTable(level int, id uint64, db *memdb.DB) error {
 		MagicNumber:    magicNumber,
 	})
 }
+
+// extendBounds extends the min and max key of table to cover the user keys
+// beyond the data which are deleted by t.
+func extendBounds(indexBlock *pb.IndexBlock, t rangedel.Tombstone) {
+	if bytes.Compare(t.Start, t.End) >= 0 {
+		return
+	}
+	minKey, maxKey := ikey.Make(t.Start, ikey.MaxSeq, ikey.KindSeek), ikey.Make(t.End, ikey.MaxSeq, ikey.KindSeek)
+	if indexBlock.MinKey == nil {
+		indexBlock.MinKey, indexBlock.MaxKey = minKey, maxKey
+		return
+	}
+	if bytes.Compare(t.Start, ikey.Key(indexBlock.MinKey).UserKey()) < 0 {
+		indexBlock.MinKey = bcmp.Min(indexBlock.MinKey, minKey)
+	}
+	// end is exclusive, the max user key of the data is covered if end is its successor.
+	maxUserKey := ikey.Key(indexBlock.MaxKey).UserKey()
+	if bytes.Compare(t.End, append(maxUserKey[:len(maxUserKey):len(maxUserKey)], 0)) > 0 {
+		indexBlock.MaxKey = bcmp.Max(indexBlock.MaxKey, maxKey)
+	}
+}
+
+// writeFile write data to a temporary file and sync it to stable storage, and then rename it to path,
+// so that a partial table is never found at path. the directory is synced to persist the rename.
+func writeFile(path string, data []byte) error {
+	tmp := path + TmpExt
+	fd, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(data); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := fd.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// SyncDir syncs the directory to persist the files created, renamed or removed in it.
+func SyncDir(dir string) error {
+	fd, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := fd.Sync(); err != nil {
+		fd.Close()
+		return err
+	}
+	return fd.Close()
+}
@@ -1,6 +1,11 @@
 package table
 
-import "github.com/klauspost/compress/zstd"
+import (
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/xgzlucario/LSM/option"
+)
 
 var (
 	encoder, _ = zstd.NewWriter(
@@ -11,11 +16,20 @@ var (
 	decoder, _ = zstd.NewReader(nil)
 )
 
-func compress(src []byte) []byte {
+func compress(src []byte, c option.Compression) []byte {
+	if c == option.NoCompression {
+		return src
+	}
 	dst := make([]byte, 0, len(src)/4)
 	return encoder.EncodeAll(src, dst)
 }
 
-func decompress(src, dst []byte) ([]byte, error) {
-	return decoder.DecodeAll(src, dst)
+func decompress(src, dst []byte, c option.Compression) ([]byte, error) {
+	switch c {
+	case option.ZstdCompression:
+		return decoder.DecodeAll(src, dst)
+	case option.NoCompression:
+		return append(dst, src...), nil
+	}
+	return nil, fmt.Errorf("table: unknown compression %d", c)
 }
@@ -0,0 +1,215 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/xgzlucario/LSM/ikey"
+	"github.com/xgzlucario/LSM/memdb"
+	"github.com/xgzlucario/LSM/option"
+)
+
+const (
+	// txnMemDBSize is the initial capacity of transaction memdb, which grows on demand.
+	txnMemDBSize = 64 * option.KB
+
+	defaultLockTimeout = time.Second
+)
+
+var (
+	ErrConflict = errors.New("lsm: transaction conflict")
+	ErrTxnDone  = errors.New("lsm: transaction has been committed or rolled back")
+)
+
+// TxnOptions is the options of pessimistic transaction, nil means the default options.
+type TxnOptions struct {
+	// LockTimeout is the max time to wait for a key lock, default is 1s.
+	LockTimeout time.Duration
+}
+
+// Txn is a transaction. Reads see the snapshot at its start and its own writes,
+// writes are buffered and applied atomically on Commit.
+//
+// An optimistic transaction fails to commit with ErrConflict if any key read by it is modified
+// after its start. A pessimistic transaction locks the keys written by it and by GetForUpdate
+// until it is done, so that other pessimistic transactions wait for them. Writes out of
+// pessimistic transactions do not take the locks.
+type Txn struct {
+	lsm  *LSM
+	snap *Snapshot
+
+	// id is the lock owner of pessimistic transaction, 0 for optimistic one.
+	id          uint64
+	lockTimeout time.Duration
+	locked      []string
+
+	// db holds the buffered writes for reading, the sequence number is the order of writes.
+	db    *memdb.DB
+	batch WriteBatch
+
+	// reads is the keys read from LSM.
+	reads map[string]struct{}
+	done  bool
+}
+
+// BeginTxn
+func (lsm *LSM) BeginTxn() *Txn {
+	return &Txn{
+		lsm:   lsm,
+		snap:  lsm.NewSnapshot(),
+		db:    memdb.New(txnMemDBSize),
+		reads: make(map[string]struct{}),
+	}
+}
+
+// BeginPessimisticTxn
+func (lsm *LSM) BeginPessimisticTxn(opts *TxnOptions) *Txn {
+	txn := lsm.BeginTxn()
+	txn.id = lsm.txnID.Add(1)
+	txn.lockTimeout = defaultLockTimeout
+	if opts != nil && opts.LockTimeout > 0 {
+		txn.lockTimeout = opts.LockTimeout
+	}
+	return txn
+}
+
+// Get find value by key from the writes of transaction, and then the snapshot.
+func (t *Txn) Get(key []byte) ([]byte, error) {
+	if t.done {
+		return nil, ErrTxnDone
+	}
+	if value, ok, err := t.getWrite(key); ok {
+		return value, err
+	}
+	if t.id == 0 {
+		t.reads[string(key)] = struct{}{}
+	}
+	return t.snap.Get(key)
+}
+
+// GetForUpdate is Get in optimistic transaction. In pessimistic transaction, it locks key
+// and then find the newest value, instead of the value in snapshot.
+func (t *Txn) GetForUpdate(key []byte) ([]byte, error) {
+	if t.id == 0 {
+		return t.Get(key)
+	}
+	if err := t.lock(key); err != nil {
+		return nil, err
+	}
+	if value, ok, err := t.getWrite(key); ok {
+		return value, err
+	}
+	return t.lsm.Get(key)
+}
+
+// getWrite find value by key from the writes of transaction, return false if not written.
+func (t *Txn) getWrite(key []byte) ([]byte, bool, error) {
+	value, kind, ok := t.db.Get(key, ikey.MaxSeq)
+	if !ok {
+		return nil, false, nil
+	}
+	if kind == ikey.KindDel {
+		return nil, true, ErrKeyNotFound
+	}
+	return slices.Clone(value), true, nil
+}
+
+// Put
+func (t *Txn) Put(key, value []byte) error {
+	return t.append(key, value, ikey.KindVal)
+}
+
+// Delete
+func (t *Txn) Delete(key []byte) error {
+	return t.append(key, nil, ikey.KindDel)
+}
+
+// Commit validates the keys read and applies the writes atomically, and then releases the locks.
+// The transaction is done whether it succeeds or not.
+func (t *Txn) Commit() error {
+	if t.done {
+		return ErrTxnDone
+	}
+	defer t.Rollback()
+
+	lsm := t.lsm
+	if err := lsm.stall(context.Background()); err != nil {
+		return err
+	}
+	lsm.writeMu.Lock()
+	defer lsm.writeMu.Unlock()
+
+	for key := range t.reads {
+		modified, err := lsm.modifiedSince([]byte(key), t.snap.seq)
+		if err != nil {
+			return err
+		}
+		if modified {
+			return ErrConflict
+		}
+	}
+	return lsm.write(&t.batch, false)
+}
+
+// Rollback discards the writes and releases the locks, it is a no-op if the transaction is done.
+func (t *Txn) Rollback() {
+	if t.done {
+		return
+	}
+	t.done = true
+	t.snap.Release()
+	t.db = nil
+	if t.id != 0 {
+		t.lsm.locks.unlock(t.id, t.locked)
+	}
+}
+
+// lock acquires the lock of key in pessimistic transaction.
+func (t *Txn) lock(key []byte) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	acquired, err := t.lsm.locks.lock(t.id, string(key), t.lockTimeout)
+	if acquired {
+		t.locked = append(t.locked, string(key))
+	}
+	return err
+}
+
+// append records the write in batch and memdb.
+func (t *Txn) append(key, value []byte, kind ikey.Kind) error {
+	if t.done {
+		return ErrTxnDone
+	}
+	if len(value) > math.MaxUint16 {
+		return ErrTooLarge
+	}
+	if t.id != 0 {
+		if err := t.lock(key); err != nil {
+			return err
+		}
+	}
+	t.batch.append(0, key, value, kind)
+
+	// grow memdb until the entry is put.
+	ik := ikey.Make(key, uint64(t.batch.Len()), kind)
+	for t.db.Put(ik, value) {
+		t.db = memdb.Merge(t.db, memdb.New(t.db.Capacity()))
+	}
+	return nil
+}
+
+// modifiedSince return true if there is any entry or range tombstone of key
+// whose sequence number is greater than seq.
+func (lsm *LSM) modifiedSince(key []byte, seq uint64) (bool, error) {
+	it := lsm.newIterator(lsm.defaultCF, ikey.MaxSeq, &IterOptions{LowerBound: key, UpperBound: append(slices.Clip(key), 0)})
+	it.iter.Seek(it.lower)
+
+	modified := it.iter.Valid() && it.iter.Key().SameUserKey(it.lower) && it.iter.Key().Seq() > seq ||
+		len(it.rangeDels) > 0 && it.rangeDels.MaxSeq(key, ikey.MaxSeq) > seq
+
+	return modified, it.Close()
+}
@@ -0,0 +1,234 @@
+package lsm
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/option"
+)
+
+func TestTxn(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const num = 100
+
+	for i := 0; i < num; i++ {
+		lsm.Put(getKey(i), getValue(i, 0))
+	}
+
+	// read your own writes, which are invisible to others before commit.
+	txn := lsm.BeginTxn()
+	for i := 0; i < num; i++ {
+		assert.Nil(txn.Put(getKey(i), getValue(i, 1)))
+	}
+	assert.Nil(txn.Delete(getKey(0)))
+
+	_, err := txn.Get(getKey(0))
+	assert.ErrorIs(err, ErrKeyNotFound)
+	for i := 1; i < num; i++ {
+		value, err := txn.Get(getKey(i))
+		assert.Nil(err)
+		assert.Equal(getValue(i, 1), value)
+	}
+	checkGet(lsm, 0, num, 0, assert)
+
+	// no key is read from LSM.
+	assert.Nil(txn.Commit())
+	checkGet(lsm, 1, num, 1, assert)
+	_, err = lsm.Get(getKey(0))
+	assert.ErrorIs(err, ErrKeyNotFound)
+
+	// done.
+	assert.ErrorIs(txn.Commit(), ErrTxnDone)
+	assert.ErrorIs(txn.Put(getKey(0), nil), ErrTxnDone)
+	_, err = txn.Get(getKey(0))
+	assert.ErrorIs(err, ErrTxnDone)
+
+	// rollback.
+	txn = lsm.BeginTxn()
+	assert.Nil(txn.Put(getKey(0), getValue(0, 2)))
+	txn.Rollback()
+	assert.ErrorIs(txn.Commit(), ErrTxnDone)
+	_, err = lsm.Get(getKey(0))
+	assert.ErrorIs(err, ErrKeyNotFound)
+}
+
+func TestTxnConflict(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	lsm.Put(getKey(0), getValue(0, 0))
+	lsm.Put(getKey(1), getValue(1, 0))
+
+	// both transactions read key 0 and write it, the later commit fails.
+	txn1, txn2 := lsm.BeginTxn(), lsm.BeginTxn()
+	for _, txn := range []*Txn{txn1, txn2} {
+		value, err := txn.Get(getKey(0))
+		assert.Nil(err)
+		assert.Equal(getValue(0, 0), value)
+	}
+	assert.Nil(txn1.Put(getKey(0), getValue(0, 1)))
+	assert.Nil(txn2.Put(getKey(0), getValue(0, 2)))
+	assert.Nil(txn1.Commit())
+	assert.ErrorIs(txn2.Commit(), ErrConflict)
+
+	value, err := lsm.Get(getKey(0))
+	assert.Nil(err)
+	assert.Equal(getValue(0, 1), value)
+
+	// blind writes and reads of other keys do not conflict.
+	txn1, txn2 = lsm.BeginTxn(), lsm.BeginTxn()
+	txn1.Get(getKey(1))
+	assert.Nil(txn1.Put(getKey(0), getValue(0, 3)))
+	assert.Nil(txn2.Put(getKey(0), getValue(0, 4)))
+	assert.Nil(txn2.Commit())
+	assert.Nil(txn1.Commit())
+
+	// absent key is created, which is invisible to the transaction.
+	txn1 = lsm.BeginTxn()
+	_, err = txn1.Get(getKey(2))
+	assert.ErrorIs(err, ErrKeyNotFound)
+	lsm.Put(getKey(2), getValue(2, 0))
+	_, err = txn1.Get(getKey(2))
+	assert.ErrorIs(err, ErrKeyNotFound)
+	assert.ErrorIs(txn1.Commit(), ErrConflict)
+
+	// key is deleted by range tombstone, and the modification is found in sstables.
+	txn1 = lsm.BeginTxn()
+	txn1.Get(getKey(1))
+	lsm.DeleteRange(getKey(1), getKey(2))
+	assert.Nil(lsm.rotate())
+	lsm.MinorCompact()
+	lsm.MajorCompact()
+	assert.ErrorIs(txn1.Commit(), ErrConflict)
+}
+
+func TestTxnLarge(t *testing.T) {
+	assert := assert.New(t)
+	opt := testOption()
+	opt.MemDBSize = 4 * option.MB
+	lsm, err := NewLSM(t.TempDir(), opt)
+	assert.Nil(err)
+	defer lsm.Close()
+
+	const num = 10000
+
+	// transaction memdb grows.
+	txn := lsm.BeginTxn()
+	for i := 0; i < num; i++ {
+		assert.Nil(txn.Put(getKey(i), getValue(i, 0)))
+	}
+	for i := 0; i < num; i++ {
+		value, err := txn.Get(getKey(i))
+		assert.Nil(err)
+		assert.Equal(getValue(i, 0), value)
+	}
+	assert.ErrorIs(txn.Put(getKey(0), make([]byte, 1<<16)), ErrTooLarge)
+	assert.Nil(txn.Commit())
+	checkGet(lsm, 0, num, 0, assert)
+}
+
+func TestPessimisticTxn(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	opts := &TxnOptions{LockTimeout: 50 * time.Millisecond}
+
+	// the key locked by txn1 is waited by txn2 until timeout.
+	txn1, txn2 := lsm.BeginPessimisticTxn(opts), lsm.BeginPessimisticTxn(opts)
+	assert.Nil(txn1.Put(getKey(0), getValue(0, 1)))
+	assert.Nil(txn1.Put(getKey(0), getValue(0, 2)))
+	assert.ErrorIs(txn2.Put(getKey(0), getValue(0, 3)), ErrLockTimeout)
+	_, err := txn2.GetForUpdate(getKey(0))
+	assert.ErrorIs(err, ErrLockTimeout)
+
+	// released by commit.
+	assert.Nil(txn1.Commit())
+	value, err := txn2.GetForUpdate(getKey(0))
+	assert.Nil(err)
+	assert.Equal(getValue(0, 2), value)
+	assert.Nil(txn2.Delete(getKey(0)))
+	assert.Nil(txn2.Commit())
+	_, err = lsm.Get(getKey(0))
+	assert.ErrorIs(err, ErrKeyNotFound)
+
+	// released by rollback.
+	txn1, txn2 = lsm.BeginPessimisticTxn(opts), lsm.BeginPessimisticTxn(opts)
+	assert.Nil(txn1.Put(getKey(0), getValue(0, 1)))
+	txn1.Rollback()
+	assert.Nil(txn2.Put(getKey(0), getValue(0, 2)))
+	assert.Nil(txn2.Commit())
+}
+
+func TestPessimisticTxnCounter(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	const workers, num = 8, 100
+
+	// increment the counter concurrently without lost update.
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < num; j++ {
+				txn := lsm.BeginPessimisticTxn(nil)
+				value, err := txn.GetForUpdate([]byte("counter"))
+				if err != nil && !errors.Is(err, ErrKeyNotFound) {
+					t.Error(err)
+				}
+				n, _ := strconv.Atoi(string(value))
+				assert.Nil(txn.Put([]byte("counter"), []byte(strconv.Itoa(n+1))))
+				assert.Nil(txn.Commit())
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := lsm.Get([]byte("counter"))
+	assert.Nil(err)
+	assert.Equal(strconv.Itoa(workers*num), string(value))
+}
+
+func TestPessimisticTxnDeadlock(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	txn1, txn2 := lsm.BeginPessimisticTxn(nil), lsm.BeginPessimisticTxn(nil)
+	assert.Nil(txn1.Put(getKey(0), getValue(0, 1)))
+	assert.Nil(txn2.Put(getKey(1), getValue(1, 2)))
+
+	// txn1 waits for txn2.
+	errC := make(chan error)
+	go func() {
+		errC <- txn1.Put(getKey(1), getValue(1, 1))
+	}()
+	for {
+		lsm.locks.mu.Lock()
+		_, waiting := lsm.locks.waitFor[txn1.id]
+		lsm.locks.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// txn2 waits for txn1 makes a deadlock.
+	assert.ErrorIs(txn2.Put(getKey(0), getValue(0, 2)), ErrDeadlock)
+	txn2.Rollback()
+
+	assert.Nil(<-errC)
+	assert.Nil(txn1.Commit())
+	checkGet(lsm, 0, 2, 1, assert)
+}
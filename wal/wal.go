@@ -0,0 +1,91 @@
+// Package wal is the write-ahead log of memdb.
+package wal
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+)
+
+const (
+	// record header: crc(4) + length(4).
+	headerSize = 8
+)
+
+var (
+	order = binary.LittleEndian
+)
+
+// Log is an append-only file of records.
+type Log struct {
+	path string
+	fd   *os.File
+	buf  []byte
+}
+
+// Create creates a new log file, it fails if the file already exists.
+func Create(path string) (*Log, error) {
+	fd, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{path: path, fd: fd}, nil
+}
+
+// Path
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Write appends a record to the log.
+// the record is written to the file in one call, so it survives a crash of the process.
+func (l *Log) Write(data []byte) error {
+	l.buf = l.buf[:0]
+	l.buf = order.AppendUint32(l.buf, crc32.ChecksumIEEE(data))
+	l.buf = order.AppendUint32(l.buf, uint32(len(data)))
+	l.buf = append(l.buf, data...)
+
+	_, err := l.fd.Write(l.buf)
+	return err
+}
+
+// Sync commits the log to stable storage.
+func (l *Log) Sync() error {
+	return l.fd.Sync()
+}
+
+// Close syncs and closes the log file.
+func (l *Log) Close() error {
+	if err := l.fd.Sync(); err != nil {
+		return err
+	}
+	return l.fd.Close()
+}
+
+// Replay reads records of the log file in order.
+// it stops at the first incomplete or corrupted record, which is left by a crash during writing.
+func Replay(path string, fn func(data []byte) error) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	for len(buf) >= headerSize {
+		crc := order.Uint32(buf)
+		size := order.Uint32(buf[4:])
+		buf = buf[headerSize:]
+
+		if uint32(len(buf)) < size {
+			return nil
+		}
+		data := buf[:size]
+		if crc32.ChecksumIEEE(data) != crc {
+			return nil
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+		buf = buf[size:]
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package wal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getRecord(i int) []byte {
+	return []byte(fmt.Sprintf("record-%08d", i))
+}
+
+func replayAll(path string) ([][]byte, error) {
+	var records [][]byte
+	err := Replay(path, func(data []byte) error {
+		records = append(records, data)
+		return nil
+	})
+	return records, err
+}
+
+func TestReplay(t *testing.T) {
+	assert := assert.New(t)
+	path := filepath.Join(t.TempDir(), "00000001.wal")
+
+	const num = 1000
+
+	log, err := Create(path)
+	assert.Nil(err)
+	assert.Equal(path, log.Path())
+
+	for i := 0; i < num; i++ {
+		assert.Nil(log.Write(getRecord(i)))
+	}
+	assert.Nil(log.Close())
+
+	// create again.
+	_, err = Create(path)
+	assert.ErrorIs(err, os.ErrExist)
+
+	records, err := replayAll(path)
+	assert.Nil(err)
+	assert.Equal(num, len(records))
+	for i, record := range records {
+		assert.Equal(getRecord(i), record)
+	}
+
+	// replay stops at the torn tail.
+	stat, _ := os.Stat(path)
+	assert.Nil(os.Truncate(path, stat.Size()-1))
+
+	records, err = replayAll(path)
+	assert.Nil(err)
+	assert.Equal(num-1, len(records))
+
+	// replay stops at the corrupted record.
+	buf, _ := os.ReadFile(path)
+	buf[len(buf)/2] ^= 0xff
+	assert.Nil(os.WriteFile(path, buf, 0644))
+
+	records, err = replayAll(path)
+	assert.Nil(err)
+	assert.Less(len(records), num/2+1)
+	for i, record := range records {
+		assert.Equal(getRecord(i), record)
+	}
+
+	// not exist.
+	_, err = replayAll(path + ".bak")
+	assert.ErrorIs(err, os.ErrNotExist)
+}
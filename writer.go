@@ -0,0 +1,104 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	// maxGroupSize is the max size of batches written by a leader as a single log record.
+	maxGroupSize = 1 << 20
+)
+
+// WriteOptions
+type WriteOptions struct {
+	// Sync syncs the log before the write returns, so that it survives a crash of the machine.
+	Sync bool
+}
+
+// writer is a write waiting in the queue.
+type writer struct {
+	batch *WriteBatch
+	sync  bool
+	done  bool
+	err   error
+}
+
+// WriteWithOptions is WriteContext with options.
+//
+// concurrent writes are queued, the first one is the leader, which writes the pending writes
+// behind it as a single log record with one sync, and then wakes them up.
+func (lsm *LSM) WriteWithOptions(ctx context.Context, batch *WriteBatch, opts *WriteOptions) error {
+	if err := lsm.stall(ctx); err != nil {
+		return err
+	}
+	w := &writer{batch: batch}
+	if opts != nil {
+		w.sync = opts.Sync
+	}
+
+	lsm.queueMu.Lock()
+	lsm.writers = append(lsm.writers, w)
+	for !w.done && lsm.writers[0] != w {
+		lsm.queueCond.Wait()
+	}
+	if w.done {
+		lsm.queueMu.Unlock()
+		return w.err
+	}
+
+	// become the leader, and take the writers behind.
+	group := []*writer{w}
+	size := len(batch.data)
+	for _, follower := range lsm.writers[1:] {
+		size += len(follower.batch.data)
+		if size > maxGroupSize {
+			break
+		}
+		group = append(group, follower)
+	}
+	lsm.queueMu.Unlock()
+
+	lsm.writeMu.Lock()
+	lsm.writeGroup(group)
+	lsm.writeMu.Unlock()
+
+	// wake up the followers and the next leader.
+	lsm.queueMu.Lock()
+	for _, g := range group {
+		g.done = true
+	}
+	lsm.writers = lsm.writers[len(group):]
+	lsm.queueCond.Broadcast()
+	lsm.queueMu.Unlock()
+
+	return w.err
+}
+
+// writeGroup writes batches of the group as a single batch, lsm.writeMu must be held.
+// if the group fails because of any batch, they are written one by one.
+func (lsm *LSM) writeGroup(group []*writer) {
+	var sync bool
+	for _, w := range group {
+		sync = sync || w.sync
+	}
+	if len(group) == 1 {
+		group[0].err = lsm.write(group[0].batch, sync)
+		return
+	}
+
+	var batch WriteBatch
+	for _, w := range group {
+		batch.appendBatch(w.batch)
+	}
+	err := lsm.write(&batch, sync)
+	if errors.Is(err, ErrTooLarge) || errors.Is(err, ErrColumnFamilyNotFound) || errors.Is(err, ErrNoMergeOperator) {
+		for _, w := range group {
+			w.err = lsm.write(w.batch, w.sync)
+		}
+		return
+	}
+	for _, w := range group {
+		w.err = err
+	}
+}
@@ -0,0 +1,87 @@
+package lsm
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/xgzlucario/LSM/wal"
+)
+
+func TestGroupCommit(t *testing.T) {
+	assert := assert.New(t)
+	lsm := newTestLSM(t, t.TempDir())
+	defer lsm.Close()
+
+	users, err := lsm.CreateColumnFamily("users", nil)
+	assert.Nil(err)
+	assert.Nil(lsm.DropColumnFamily(users))
+
+	const num = 100
+
+	// writes are queued behind the blocked leader, and then written by the next leader.
+	queueWrites := func(version int, dropped bool) {
+		lsm.writeMu.Lock()
+		var wg sync.WaitGroup
+		waitQueue := func(n int) {
+			assert.Eventually(func() bool {
+				lsm.queueMu.Lock()
+				defer lsm.queueMu.Unlock()
+				return len(lsm.writers) == n
+			}, time.Second, time.Millisecond)
+		}
+		put := func(i int) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var batch WriteBatch
+				batch.Put(getKey(i), getValue(i, version))
+				assert.Nil(lsm.WriteWithOptions(context.Background(), &batch, &WriteOptions{Sync: i%2 == 0}))
+			}()
+		}
+
+		put(0)
+		waitQueue(1)
+		for i := 1; i < num; i++ {
+			put(i)
+		}
+		// the write to dropped column family fails alone.
+		n := num
+		if dropped {
+			n++
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var batch WriteBatch
+				batch.PutCF(users, getKey(0), nil)
+				assert.ErrorIs(lsm.Write(&batch), ErrColumnFamilyNotFound)
+			}()
+		}
+		waitQueue(n)
+
+		lsm.writeMu.Unlock()
+		wg.Wait()
+	}
+	countRecords := func() int {
+		var records int
+		assert.Nil(wal.Replay(lsm.logPath(lsm.logID), func([]byte) error {
+			records++
+			return nil
+		}))
+		return records
+	}
+
+	// the leader writes alone, and then the next leader writes the others in a record.
+	queueWrites(0, false)
+	checkGet(lsm, 0, num, 0, assert)
+	assert.Equal(uint64(num), lsm.seq.Load())
+	assert.Equal(2, countRecords())
+
+	// the group fails, and then they are written one by one.
+	queueWrites(1, true)
+	checkGet(lsm, 0, num, 1, assert)
+	assert.Equal(uint64(num*2), lsm.seq.Load())
+	assert.Equal(2+num, countRecords())
+}